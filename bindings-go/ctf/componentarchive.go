@@ -17,15 +17,15 @@ package ctf
 import (
 	"archive/tar"
 	"bytes"
-	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"time"
+	"sort"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/mandelsoft/vfs/pkg/memoryfs"
 	"github.com/mandelsoft/vfs/pkg/osfs"
 	"github.com/mandelsoft/vfs/pkg/projectionfs"
@@ -57,39 +57,42 @@ func ComponentArchiveFromPath(path string) (*ComponentArchive, error) {
 	return NewComponentArchiveFromFilesystem(fs)
 }
 
-// ComponentArchiveFromCompressedCTF creates a new component archive from a zipped CTF tar.
+// ComponentArchiveFromCompressedCTF creates a new component archive from a compressed CTF tar.
+// The compression is detected automatically, so that this is equivalent to ComponentArchiveFromCTF.
 func ComponentArchiveFromCompressedCTF(path string) (*ComponentArchive, error) {
-	// we expect that the path point to a targz
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("unable to open tar archive from %s: %w", path, err)
-	}
-	defer file.Close()
-	reader, err := gzip.NewReader(file)
-	if err != nil {
-		return nil, fmt.Errorf("unable to open gzip reader for %s: %w", path, err)
-	}
-	return NewComponentArchiveFromTarReader(reader)
+	return ComponentArchiveFromCTF(path)
 }
 
 // ComponentArchiveFromCTF creates a new componet archive from a CTF tar file.
+// The tar can be uncompressed or compressed with gzip or zstd.
 func ComponentArchiveFromCTF(path string) (*ComponentArchive, error) {
-	// we expect that the path point to a tar
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open tar archive from %s: %w", path, err)
 	}
 	defer file.Close()
-	return NewComponentArchiveFromTarReader(file)
+	return NewComponentArchiveFromCompressedTarReader(file)
+}
+
+// NewComponentArchiveFromCompressedTarReader creates a new component archive from a tar
+// that is uncompressed or compressed with gzip or zstd.
+func NewComponentArchiveFromCompressedTarReader(in io.Reader, opts ...ExtractOption) (*ComponentArchive, error) {
+	reader, _, err := NewDecompressingReader(in)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return NewComponentArchiveFromTarReader(reader, opts...)
 }
 
 // NewComponentArchiveFromTarReader creates a new manifest builder from a input reader.
 // todo: make the fs configurable to also use a temporary filesystem
-func NewComponentArchiveFromTarReader(in io.Reader) (*ComponentArchive, error) {
+// The extract options limit the extracted content of the tar.
+func NewComponentArchiveFromTarReader(in io.Reader, opts ...ExtractOption) (*ComponentArchive, error) {
 	// the archive is untared to a memory fs that the builder can work
 	// as it would be a default filesystem.
 	fs := memoryfs.New()
-	if err := ExtractTarToFs(fs, in); err != nil {
+	if err := ExtractTarToFs(fs, in, opts...); err != nil {
 		return nil, fmt.Errorf("unable to extract tar: %w", err)
 	}
 
@@ -120,6 +123,8 @@ func NewComponentArchiveFromFilesystem(fs vfs.FileSystem, decodeOpts ...codec.De
 type ComponentArchive struct {
 	ComponentDescriptor *v2.ComponentDescriptor
 	fs                  vfs.FileSystem
+	// sharedBlobs optionally opens referenced blobs that are not contained in the archive.
+	sharedBlobs sharedBlobOpener
 	BlobResolver
 }
 
@@ -267,6 +272,49 @@ func (ca *ComponentArchive) AddResourceFromResolver(ctx context.Context, res *v2
 	return nil
 }
 
+// AddSourceFromResolver adds a blob source to the current archive.
+// The resolver has to implement the SourceBlobResolver interface.
+// If the specified source already exists it will be overwritten.
+func (ca *ComponentArchive) AddSourceFromResolver(ctx context.Context, src *v2.Source, resolver BlobResolver) error {
+	if src == nil {
+		return errors.New("a source has to be defined")
+	}
+	sourceResolver, ok := resolver.(SourceBlobResolver)
+	if !ok {
+		return UnsupportedResolveType
+	}
+	info, err := sourceResolver.InfoSource(ctx, *src)
+	if err != nil {
+		return fmt.Errorf("unable to get blob info from resolver: %w", err)
+	}
+
+	var blob bytes.Buffer
+	if _, err := sourceResolver.ResolveSource(ctx, *src, &blob); err != nil {
+		return fmt.Errorf("unable to get blob from resolver: %w", err)
+	}
+	return ca.AddSource(src, *info, &blob)
+}
+
+// InfoSource returns the blob info of a source of the component archive.
+// UnsupportedResolveType is returned if the blob resolver of the archive cannot resolve sources.
+func (ca *ComponentArchive) InfoSource(ctx context.Context, src v2.Source) (*BlobInfo, error) {
+	resolver, ok := ca.BlobResolver.(SourceBlobResolver)
+	if !ok {
+		return nil, UnsupportedResolveType
+	}
+	return resolver.InfoSource(ctx, src)
+}
+
+// ResolveSource fetches the blob of a source of the component archive.
+// UnsupportedResolveType is returned if the blob resolver of the archive cannot resolve sources.
+func (ca *ComponentArchive) ResolveSource(ctx context.Context, src v2.Source, writer io.Writer) (*BlobInfo, error) {
+	resolver, ok := ca.BlobResolver.(SourceBlobResolver)
+	if !ok {
+		return nil, UnsupportedResolveType
+	}
+	return resolver.ResolveSource(ctx, src, writer)
+}
+
 // ensureBlobsPath ensures that the blob directory exists
 func (ca *ComponentArchive) ensureBlobsPath() error {
 	if _, err := ca.fs.Stat(BlobsDirectoryName); err != nil {
@@ -279,16 +327,31 @@ func (ca *ComponentArchive) ensureBlobsPath() error {
 }
 
 // WriteTarGzip tars the current components descriptor and its artifacts.
-func (ca *ComponentArchive) WriteTarGzip(writer io.Writer) error {
-	gw := gzip.NewWriter(writer)
-	if err := ca.WriteTar(gw); err != nil {
+func (ca *ComponentArchive) WriteTarGzip(writer io.Writer, opts ...WriteOption) error {
+	options := (&WriteOptions{}).ApplyOptions(opts)
+	gw := options.newGzipWriter(writer)
+	if err := ca.WriteTar(gw, opts...); err != nil {
 		return err
 	}
 	return gw.Close()
 }
 
+// WriteTarZstd tars the current components descriptor and its artifacts and compresses them with zstd.
+func (ca *ComponentArchive) WriteTarZstd(writer io.Writer, opts ...WriteOption) error {
+	zw, err := zstd.NewWriter(writer)
+	if err != nil {
+		return fmt.Errorf("unable to create zstd writer: %w", err)
+	}
+	if err := ca.WriteTar(zw, opts...); err != nil {
+		_ = zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
 // WriteTar tars the current components descriptor and its artifacts.
-func (ca *ComponentArchive) WriteTar(writer io.Writer) error {
+func (ca *ComponentArchive) WriteTar(writer io.Writer, opts ...WriteOption) error {
+	options := (&WriteOptions{}).ApplyOptions(opts)
 	tw := tar.NewWriter(writer)
 
 	// write component descriptor
@@ -300,8 +363,9 @@ func (ca *ComponentArchive) WriteTar(writer io.Writer) error {
 		Name:    ComponentDescriptorFileName,
 		Size:    int64(len(cdBytes)),
 		Mode:    0644,
-		ModTime: time.Now(),
+		ModTime: options.modTime(),
 	}
+	options.normalizeHeader(cdHeader)
 
 	if err := tw.WriteHeader(cdHeader); err != nil {
 		return fmt.Errorf("unable to write component descriptor header: %w", err)
@@ -311,43 +375,47 @@ func (ca *ComponentArchive) WriteTar(writer io.Writer) error {
 	}
 
 	// add all blobs
-	err = tw.WriteHeader(&tar.Header{
+	blobsHeader := &tar.Header{
 		Typeflag: tar.TypeDir,
 		Name:     BlobsDirectoryName,
 		Mode:     0644,
-		ModTime:  time.Now(),
-	})
-	if err != nil {
+		ModTime:  options.modTime(),
+	}
+	options.normalizeHeader(blobsHeader)
+	if err := tw.WriteHeader(blobsHeader); err != nil {
 		return fmt.Errorf("unable to write blob directory: %w", err)
 	}
 
-	blobs, err := vfs.ReadDir(ca.fs, BlobsDirectoryName)
+	blobs, err := ca.blobs()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return fmt.Errorf("unable to read blob directory: %w", err)
+		return err
+	}
+	if options.Reproducible {
+		sort.Slice(blobs, func(i, j int) bool {
+			return blobs[i].name < blobs[j].name
+		})
 	}
-	for _, blobInfo := range blobs {
-		blobpath := BlobPath(blobInfo.Name())
+	for _, blob := range blobs {
+		blobpath := BlobPath(blob.name)
 		header := &tar.Header{
 			Name:    blobpath,
-			Size:    blobInfo.Size(),
+			Size:    blob.size,
 			Mode:    0644,
-			ModTime: time.Now(),
+			ModTime: options.modTime(),
 		}
+		options.normalizeHeader(header)
 		if err := tw.WriteHeader(header); err != nil {
 			return fmt.Errorf("unable to write blob header: %w", err)
 		}
 
-		blob, err := ca.fs.Open(blobpath)
+		reader, err := blob.open()
 		if err != nil {
 			return fmt.Errorf("unable to open blob: %w", err)
 		}
-		if _, err := io.Copy(tw, blob); err != nil {
+		if _, err := io.Copy(tw, reader); err != nil {
 			return fmt.Errorf("unable to write blob content: %w", err)
 		}
-		if err := blob.Close(); err != nil {
+		if err := reader.Close(); err != nil {
 			return fmt.Errorf("unable to close blob %s: %w", blobpath, err)
 		}
 	}
@@ -357,7 +425,12 @@ func (ca *ComponentArchive) WriteTar(writer io.Writer) error {
 
 // WriteToFilesystem writes the current component archive to a filesystem
 func (ca *ComponentArchive) WriteToFilesystem(fs vfs.FileSystem, path string) error {
-	// create the directory structure with the blob directory
+	// create the directory structure with the blob directory.
+	// The directories are created one after another as projected filesystems
+	// are not able to create multiple missing directories at once.
+	if err := fs.MkdirAll(path, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create output directory %q: %s", path, err.Error())
+	}
 	if err := fs.MkdirAll(filepath.Join(path, BlobsDirectoryName), os.ModePerm); err != nil {
 		return fmt.Errorf("unable to create output directory %q: %s", path, err.Error())
 	}
@@ -371,35 +444,14 @@ func (ca *ComponentArchive) WriteToFilesystem(fs vfs.FileSystem, path string) er
 	}
 
 	// copy all blobs
-	blobInfos, err := vfs.ReadDir(ca.fs, BlobsDirectoryName)
+	blobs, err := ca.blobs()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
 		return fmt.Errorf("unable to read blobs: %w", err)
 	}
-	for _, blobInfo := range blobInfos {
-		if blobInfo.IsDir() {
-			continue
-		}
-		inpath := BlobPath(blobInfo.Name())
-		outpath := filepath.Join(path, BlobsDirectoryName, blobInfo.Name())
-		blob, err := ca.fs.Open(inpath)
-		if err != nil {
-			return fmt.Errorf("unable to open input blob %q: %w", inpath, err)
-		}
-		out, err := fs.OpenFile(outpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
-		if err != nil {
-			return fmt.Errorf("unable to open output blob %q: %w", outpath, err)
-		}
-		if _, err := io.Copy(out, blob); err != nil {
-			return fmt.Errorf("unable to copy blob from %q to %q: %w", inpath, outpath, err)
-		}
-		if err := out.Close(); err != nil {
-			return fmt.Errorf("unable to close output blob %s: %w", outpath, err)
-		}
-		if err := blob.Close(); err != nil {
-			return fmt.Errorf("unable to close input blob %s: %w", outpath, err)
+	for _, blob := range blobs {
+		outpath := filepath.Join(path, BlobsDirectoryName, blob.name)
+		if err := copyBlob(blob, fs, outpath); err != nil {
+			return fmt.Errorf("unable to copy blob %q to %q: %w", BlobPath(blob.name), outpath, err)
 		}
 	}
 
@@ -410,6 +462,8 @@ func (ca *ComponentArchive) WriteToFilesystem(fs vfs.FileSystem, path string) er
 // "LocalFilesystemBlob" access types.
 type ComponentArchiveBlobResolver struct {
 	fs vfs.FileSystem
+	// sharedBlobs optionally opens blobs that are not contained in the filesystem.
+	sharedBlobs sharedBlobOpener
 }
 
 // NewComponentArchiveBlobResolver creates new ComponentArchive blob that can resolve local filesystem references.
@@ -421,6 +475,8 @@ func NewComponentArchiveBlobResolver(fs vfs.FileSystem) *ComponentArchiveBlobRes
 	}
 }
 
+var _ SourceBlobResolver = &ComponentArchiveBlobResolver{}
+
 func (ca *ComponentArchiveBlobResolver) CanResolve(res v2.Resource) bool {
 	return res.Access != nil && res.Access.GetType() == v2.LocalFilesystemBlobType
 }
@@ -453,7 +509,17 @@ func (ca *ComponentArchiveBlobResolver) Resolve(ctx context.Context, res v2.Reso
 	return info, nil
 }
 
-func (ca *ComponentArchiveBlobResolver) resolve(_ context.Context, res v2.Resource) (*BlobInfo, vfs.File, error) {
+// InfoSource returns the blob info of a source.
+func (ca *ComponentArchiveBlobResolver) InfoSource(ctx context.Context, src v2.Source) (*BlobInfo, error) {
+	return ca.Info(ctx, sourceResource(src))
+}
+
+// ResolveSource fetches the blob of a source and writes it to the given writer.
+func (ca *ComponentArchiveBlobResolver) ResolveSource(ctx context.Context, src v2.Source, writer io.Writer) (*BlobInfo, error) {
+	return ca.Resolve(ctx, sourceResource(src), writer)
+}
+
+func (ca *ComponentArchiveBlobResolver) resolve(_ context.Context, res v2.Resource) (*BlobInfo, io.ReadCloser, error) {
 	if res.Access == nil || res.Access.GetType() != v2.LocalFilesystemBlobType {
 		return nil, nil, UnsupportedResolveType
 	}
@@ -469,6 +535,9 @@ func (ca *ComponentArchiveBlobResolver) resolve(_ context.Context, res v2.Resour
 
 	info, err := ca.fs.Stat(blobpath)
 	if err != nil {
+		if os.IsNotExist(err) && ca.sharedBlobs != nil {
+			return ca.resolveShared(localFSAccess.Filename, mediaType)
+		}
 		return nil, nil, fmt.Errorf("unable to get fileinfo for %s: %w", blobpath, err)
 	}
 	if info.IsDir() {
@@ -493,39 +562,40 @@ func (ca *ComponentArchiveBlobResolver) resolve(_ context.Context, res v2.Resour
 	}, file, nil
 }
 
+// resolveShared resolves a blob that is only contained in the shared blob directory.
+func (ca *ComponentArchiveBlobResolver) resolveShared(name, mediaType string) (*BlobInfo, io.ReadCloser, error) {
+	blobpath := BlobPath(name)
+	reader, size, err := ca.sharedBlobs(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open shared blob %s: %w", name, err)
+	}
+	if reader == nil {
+		return nil, nil, fmt.Errorf("unable to get fileinfo for %s: %w", blobpath, os.ErrNotExist)
+	}
+	dig, err := digest.FromReader(reader)
+	if err != nil {
+		_ = reader.Close()
+		return nil, nil, fmt.Errorf("unable to generate dig from %s: %w", name, err)
+	}
+	if err := reader.Close(); err != nil {
+		return nil, nil, err
+	}
+	// the shared blob is opened again as shared blob readers are not seekable.
+	reader, _, err = ca.sharedBlobs(name)
+	if err == nil && reader == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open shared blob %s: %w", name, err)
+	}
+	return &BlobInfo{
+		MediaType: mediaType,
+		Digest:    dig.String(),
+		Size:      size,
+	}, reader, nil
+}
+
 // BlobPath returns the path to the blob for a given name.
 func BlobPath(name string) string {
 	return filepath.Join(BlobsDirectoryName, name)
 }
-
-// ExtractTarToFs writes a tar stream to a filesystem.
-func ExtractTarToFs(fs vfs.FileSystem, in io.Reader) error {
-	tr := tar.NewReader(in)
-	for {
-		header, err := tr.Next()
-		if err != nil {
-			if err == io.EOF {
-				return nil
-			}
-			return err
-		}
-
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := fs.MkdirAll(header.Name, os.FileMode(header.Mode)); err != nil {
-				return fmt.Errorf("unable to create directory %s: %w", header.Name, err)
-			}
-		case tar.TypeReg:
-			file, err := fs.OpenFile(header.Name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(header.Mode))
-			if err != nil {
-				return fmt.Errorf("unable to open file %s: %w", header.Name, err)
-			}
-			if _, err := io.Copy(file, tr); err != nil {
-				return fmt.Errorf("unable to copy tar file to filesystem: %w", err)
-			}
-			if err := file.Close(); err != nil {
-				return fmt.Errorf("unable to close file %s: %w", header.Name, err)
-			}
-		}
-	}
-}
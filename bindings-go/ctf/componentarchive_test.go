@@ -0,0 +1,236 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mandelsoft/vfs/pkg/memoryfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+)
+
+var _ = Describe("ComponentArchive", func() {
+
+	Context("Check", func() {
+
+		It("should report a consistent component archive", func() {
+			ca := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(ca, "res", []byte("blob"))
+
+			report, err := ca.Check()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.IsConsistent()).To(BeTrue())
+		})
+
+		It("should report missing, unreferenced, mismatching blobs and directories", func() {
+			fs := memoryfs.New()
+			ca := ctf.NewComponentArchive(newTestComponentArchive("example.com/a", "0.0.0").ComponentDescriptor, fs)
+			addTestBlob(ca, "res", []byte("blob v1"))
+			// replacing the resource leaves the previous blob in the archive.
+			addTestBlob(ca, "res", []byte("blob v2"))
+			addTestBlob(ca, "deleted", []byte("deleted"))
+			Expect(fs.Remove(ctf.BlobPath(digest.FromString("deleted").String()))).To(Succeed())
+			mismatch := digest.FromString("original").String()
+			Expect(ca.AddResource(&cdv2.Resource{
+				IdentityObjectMeta: cdv2.IdentityObjectMeta{Name: "mismatch", Version: "0.0.0", Type: "blob"},
+				Relation:           cdv2.LocalRelation,
+			}, ctf.BlobInfo{MediaType: "txt", Digest: mismatch}, bytes.NewBufferString("modified"))).To(Succeed())
+			Expect(fs.MkdirAll(ctf.BlobPath("dir"), os.ModePerm)).To(Succeed())
+
+			report, err := ca.Check()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.IsConsistent()).To(BeFalse())
+			Expect(report.MissingBlobs).To(ConsistOf(digest.FromString("deleted").String()))
+			Expect(report.UnreferencedBlobs).To(ConsistOf(digest.FromString("blob v1").String(), "dir"))
+			Expect(report.DigestMismatches).To(ConsistOf(mismatch))
+			Expect(report.Directories).To(ConsistOf("dir"))
+		})
+
+	})
+
+	Context("Prune", func() {
+
+		It("should remove all unreferenced blobs", func() {
+			fs := memoryfs.New()
+			ca := ctf.NewComponentArchive(newTestComponentArchive("example.com/a", "0.0.0").ComponentDescriptor, fs)
+			addTestBlob(ca, "res", []byte("blob v1"))
+			addTestBlob(ca, "res", []byte("blob v2"))
+			Expect(fs.MkdirAll(ctf.BlobPath("dir"), os.ModePerm)).To(Succeed())
+
+			removed, err := ca.Prune()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(removed).To(ConsistOf(digest.FromString("blob v1").String(), "dir"))
+			Expect(vfs.Exists(fs, ctf.BlobPath(digest.FromString("blob v1").String()))).To(BeFalse())
+			Expect(vfs.Exists(fs, ctf.BlobPath(digest.FromString("blob v2").String()))).To(BeTrue())
+
+			report, err := ca.Check()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.IsConsistent()).To(BeTrue())
+		})
+
+	})
+
+	Context("Directory blobs", func() {
+
+		newDirectory := func(files map[string]string) vfs.FileSystem {
+			fs := memoryfs.New()
+			for name, content := range files {
+				Expect(fs.MkdirAll(filepath.Dir(name), os.ModePerm)).To(Succeed())
+				Expect(vfs.WriteFile(fs, name, []byte(content), os.ModePerm)).To(Succeed())
+			}
+			return fs
+		}
+
+		newResource := func() *cdv2.Resource {
+			return &cdv2.Resource{
+				IdentityObjectMeta: cdv2.IdentityObjectMeta{Name: "dir", Version: "0.0.0", Type: "directory"},
+				Relation:           cdv2.LocalRelation,
+			}
+		}
+
+		It("should add a directory as blob and extract it again", func() {
+			fs := newDirectory(map[string]string{
+				"/data/a.txt":          "a",
+				"/data/sub/b.txt":      "b",
+				"/data/sub/c.tmp":      "c",
+				"/data/vendor/d.txt":   "d",
+				"/data/empty/.keep":    "",
+				"/outside/ignored.txt": "ignored",
+			})
+			ca := newTestComponentArchive("example.com/a", "0.0.0")
+			Expect(ca.AddResourceFromDirectory(newResource(), fs, "/data", ctf.DirectoryOptions{
+				ExcludePatterns: []string{"*/*.tmp", "vendor"},
+			})).To(Succeed())
+			res := ca.ComponentDescriptor.Resources[0]
+			info, err := ca.Info(context.Background(), res)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.MediaType).To(Equal(ctf.MediaTypeTarGzip))
+
+			out := memoryfs.New()
+			Expect(ctf.ExtractDirectoryBlob(context.Background(), ca, res, out, "/out")).To(Succeed())
+			Expect(vfs.ReadFile(out, "/out/a.txt")).To(Equal([]byte("a")))
+			Expect(vfs.ReadFile(out, "/out/sub/b.txt")).To(Equal([]byte("b")))
+			Expect(vfs.FileExists(out, "/out/empty/.keep")).To(BeTrue())
+			Expect(vfs.Exists(out, "/out/sub/c.tmp")).To(BeFalse())
+			Expect(vfs.Exists(out, "/out/vendor")).To(BeFalse())
+		})
+
+		It("should pack the same content to the same digest", func() {
+			files := map[string]string{
+				"/data/a.txt":     "a",
+				"/data/sub/b.txt": "b",
+			}
+			ca1 := newTestComponentArchive("example.com/a", "0.0.0")
+			Expect(ca1.AddResourceFromDirectory(newResource(), newDirectory(files), "/data", ctf.DirectoryOptions{Format: ctf.ArchiveFormatTar})).To(Succeed())
+			time.Sleep(1100 * time.Millisecond)
+			ca2 := newTestComponentArchive("example.com/a", "0.0.0")
+			Expect(ca2.AddResourceFromDirectory(newResource(), newDirectory(files), "/data", ctf.DirectoryOptions{Format: ctf.ArchiveFormatTar})).To(Succeed())
+
+			info1, err := ca1.Info(context.Background(), ca1.ComponentDescriptor.Resources[0])
+			Expect(err).ToNot(HaveOccurred())
+			info2, err := ca2.Info(context.Background(), ca2.ComponentDescriptor.Resources[0])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info1.MediaType).To(Equal(ctf.MediaTypeTar))
+			Expect(info1.Digest).To(Equal(info2.Digest))
+		})
+
+		It("should add all files matching a glob", func() {
+			fs := newDirectory(map[string]string{
+				"/data/a.yaml":     "a",
+				"/data/b.txt":      "b",
+				"/data/sub/c.yaml": "c",
+			})
+			ca := newTestComponentArchive("example.com/a", "0.0.0")
+			Expect(ca.AddResourceFromDirectory(newResource(), fs, "/data/*.yaml", ctf.DirectoryOptions{})).To(Succeed())
+
+			out := memoryfs.New()
+			Expect(ctf.ExtractDirectoryBlob(context.Background(), ca, ca.ComponentDescriptor.Resources[0], out, "/out")).To(Succeed())
+			Expect(vfs.FileExists(out, "/out/a.yaml")).To(BeTrue())
+			Expect(vfs.Exists(out, "/out/b.txt")).To(BeFalse())
+			Expect(vfs.Exists(out, "/out/sub")).To(BeFalse())
+		})
+
+		It("should pack links within the directory and reject links that point outside of it", func() {
+			fs := newDirectory(map[string]string{
+				"/data/a.txt":     "a",
+				"/data/sub/b.txt": "b",
+			})
+			Expect(fs.Symlink("../a.txt", "/data/sub/link")).To(Succeed())
+			ca := newTestComponentArchive("example.com/a", "0.0.0")
+			Expect(ca.AddResourceFromDirectory(newResource(), fs, "/data", ctf.DirectoryOptions{})).To(Succeed())
+			out := memoryfs.New()
+			Expect(ctf.ExtractDirectoryBlob(context.Background(), ca, ca.ComponentDescriptor.Resources[0], out, "/out")).To(Succeed())
+			Expect(out.Readlink("/out/sub/link")).To(Equal("../a.txt"))
+
+			for _, target := range []string{"/data/a.txt", "../../outside", "../.."} {
+				Expect(fs.Remove("/data/sub/link")).To(Succeed())
+				Expect(fs.Symlink(target, "/data/sub/link")).To(Succeed())
+				err := ca.AddResourceFromDirectory(newResource(), fs, "/data", ctf.DirectoryOptions{})
+				Expect(errors.Is(err, ctf.UnsafeArchiveError)).To(BeTrue(), target)
+			}
+		})
+
+	})
+
+	Context("Sources", func() {
+
+		It("should resolve source blobs from archives, ctfs and aggregated resolvers", func() {
+			ctx := context.Background()
+			data := []byte("source blob")
+			ca := newTestComponentArchive("example.com/a", "0.0.0")
+			Expect(ca.AddSource(&cdv2.Source{
+				IdentityObjectMeta: cdv2.IdentityObjectMeta{Name: "src", Version: "0.0.0", Type: "git"},
+			}, ctf.BlobInfo{MediaType: "application/x-tar", Digest: digest.FromBytes(data).String(), Size: int64(len(data))}, bytes.NewBuffer(data))).To(Succeed())
+			src := ca.ComponentDescriptor.Sources[0]
+
+			expectSource := func(resolver ctf.BlobResolver) {
+				sourceResolver, ok := resolver.(ctf.SourceBlobResolver)
+				Expect(ok).To(BeTrue())
+				var blob bytes.Buffer
+				info, err := sourceResolver.ResolveSource(ctx, src, &blob)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(blob.Bytes()).To(Equal(data))
+				Expect(info.MediaType).To(Equal("application/x-tar"))
+			}
+			expectSource(ca.BlobResolver)
+			aggregated, err := ctf.NewAggregatedBlobResolver(ca.BlobResolver)
+			Expect(err).ToNot(HaveOccurred())
+			expectSource(aggregated)
+
+			fs := memoryfs.New()
+			ctfArchive := newTestCTF(fs, "/ctf.tar")
+			Expect(ctfArchive.AddComponentArchive(ca, ctf.ArchiveFormatTar)).To(Succeed())
+			Expect(ctfArchive.Write()).To(Succeed())
+			Expect(ctfArchive.Close()).To(Succeed())
+
+			indexed, err := ctf.NewIndexedCTF(fs, "/ctf.tar")
+			Expect(err).ToNot(HaveOccurred())
+			defer indexed.Close()
+			_, blobResolver, err := indexed.ResolveWithBlobResolver(ctx, nil, "example.com/a", "0.0.0")
+			Expect(err).ToNot(HaveOccurred())
+			expectSource(blobResolver)
+
+			copied := newTestComponentArchive("example.com/b", "0.0.0")
+			Expect(copied.AddSourceFromResolver(ctx, &src, blobResolver)).To(Succeed())
+			var blob bytes.Buffer
+			_, err = copied.ResolveSource(ctx, copied.ComponentDescriptor.Sources[0], &blob)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(blob.Bytes()).To(Equal(data))
+		})
+
+	})
+
+})
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	"github.com/opencontainers/go-digest"
+
+	v2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+)
+
+// CheckReport describes the consistency of the blobs of a component archive.
+// All lists contain the names of the blobs within the blob directory and are sorted.
+type CheckReport struct {
+	// MissingBlobs are blobs that are referenced by a resource or source but do not exist.
+	MissingBlobs []string
+	// UnreferencedBlobs are files and directories in the blob directory that are not referenced by any resource or source.
+	UnreferencedBlobs []string
+	// DigestMismatches are blobs that are named by a digest that does not match their content.
+	DigestMismatches []string
+	// Directories are directories in the blob directory.
+	// Directories cannot be resolved as blobs.
+	Directories []string
+}
+
+// IsConsistent returns whether the check found no issues.
+func (r *CheckReport) IsConsistent() bool {
+	return len(r.MissingBlobs) == 0 &&
+		len(r.UnreferencedBlobs) == 0 &&
+		len(r.DigestMismatches) == 0 &&
+		len(r.Directories) == 0
+}
+
+// Check checks the consistency of the blobs of the component archive
+// with the local blobs that are referenced by the resources and sources of its component descriptor.
+// Referenced blobs that are read from the shared blob directory of a ctf are not missing.
+func (ca *ComponentArchive) Check() (*CheckReport, error) {
+	referenced, err := localBlobNames(ca.ComponentDescriptor)
+	if err != nil {
+		return nil, err
+	}
+	report := &CheckReport{
+		MissingBlobs:      make([]string, 0),
+		UnreferencedBlobs: make([]string, 0),
+		DigestMismatches:  make([]string, 0),
+		Directories:       make([]string, 0),
+	}
+
+	existing := map[string]bool{}
+	infos, err := vfs.ReadDir(ca.fs, BlobsDirectoryName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read blob directory: %w", err)
+	}
+	for _, info := range infos {
+		name := info.Name()
+		existing[name] = true
+		if !referenced[name] {
+			report.UnreferencedBlobs = append(report.UnreferencedBlobs, name)
+		}
+		if info.IsDir() {
+			report.Directories = append(report.Directories, name)
+			continue
+		}
+		if _, err := digest.Parse(name); err != nil {
+			continue
+		}
+		ok, err := isDigestBlob(ca.fs, BlobPath(name), name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			report.DigestMismatches = append(report.DigestMismatches, name)
+		}
+	}
+	shared := map[string]bool{}
+	blobs, err := ca.blobs()
+	if err != nil {
+		return nil, err
+	}
+	for _, blob := range blobs {
+		shared[blob.name] = blob.shared
+	}
+	for name := range referenced {
+		if !existing[name] && !shared[name] {
+			report.MissingBlobs = append(report.MissingBlobs, name)
+		}
+	}
+	sort.Strings(report.MissingBlobs)
+	return report, nil
+}
+
+// Prune removes all files and directories from the blob directory
+// that are not referenced by any resource or source of the component archive.
+// The names of the removed blobs are returned.
+func (ca *ComponentArchive) Prune() ([]string, error) {
+	report, err := ca.Check()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range report.UnreferencedBlobs {
+		if err := ca.fs.RemoveAll(BlobPath(name)); err != nil {
+			return nil, fmt.Errorf("unable to remove blob %q: %w", name, err)
+		}
+	}
+	return report.UnreferencedBlobs, nil
+}
+
+// localBlobNames returns the filenames of all local filesystem blobs
+// that are referenced by the resources and sources of the component descriptor.
+func localBlobNames(cd *v2.ComponentDescriptor) (map[string]bool, error) {
+	accesses := make([]*v2.UnstructuredTypedObject, 0)
+	for _, res := range cd.Resources {
+		accesses = append(accesses, res.Access)
+	}
+	for _, src := range cd.Sources {
+		accesses = append(accesses, src.Access)
+	}
+	names := map[string]bool{}
+	for _, access := range accesses {
+		if access == nil || access.GetType() != v2.LocalFilesystemBlobType {
+			continue
+		}
+		localFSAccess := &v2.LocalFilesystemBlobAccess{}
+		if err := access.DecodeInto(localFSAccess); err != nil {
+			return nil, fmt.Errorf("unable to decode access to type '%s': %w", access.GetType(), err)
+		}
+		names[localFSAccess.Filename] = true
+	}
+	return names, nil
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression describes the compression of a tar.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// magic bytes that identify compressed streams.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// maxMagicLength is the number of bytes that are needed to detect all compressions.
+const maxMagicLength = 4
+
+// DetectCompression detects the compression of a stream from its first bytes.
+func DetectCompression(magic []byte) Compression {
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(magic, zstdMagic):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// NewDecompressingReader returns a reader that decompresses the given stream.
+// The compression is detected from the magic bytes of the stream,
+// uncompressed streams are returned as they are.
+// The user should close the returned reader to release all resources of the decompressor.
+func NewDecompressingReader(in io.Reader) (io.ReadCloser, Compression, error) {
+	br := bufio.NewReader(in)
+	magic, err := br.Peek(maxMagicLength)
+	if err != nil && err != io.EOF {
+		return nil, CompressionNone, fmt.Errorf("unable to read magic bytes: %w", err)
+	}
+	compression := DetectCompression(magic)
+	reader, err := newDecompressor(br, compression)
+	if err != nil {
+		return nil, CompressionNone, err
+	}
+	return reader, compression, nil
+}
+
+// newDecompressor returns a reader that decompresses the stream with the given compression.
+func newDecompressor(in io.Reader, compression Compression) (io.ReadCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(in)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open gzip reader: %w", err)
+		}
+		return gr, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(in)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open zstd reader: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return io.NopCloser(in), nil
+	}
+}
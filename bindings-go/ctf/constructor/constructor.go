@@ -0,0 +1,358 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package constructor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mandelsoft/vfs/pkg/memoryfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	"github.com/opencontainers/go-digest"
+	"sigs.k8s.io/yaml"
+
+	v2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/apis/v2/signatures"
+	"github.com/gardener/component-spec/bindings-go/apis/v2/validation"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+)
+
+// InputType describes the type of an input.
+type InputType string
+
+const (
+	// FileInputType adds the content of a file as blob.
+	FileInputType InputType = "file"
+	// DirectoryInputType adds a directory as tar or gzipped tar blob.
+	DirectoryInputType InputType = "dir"
+	// TextInputType adds inline text as blob.
+	TextInputType InputType = "text"
+	// OCIImageInputType references an existing oci image.
+	// No blob is added for these inputs.
+	OCIImageInputType InputType = "ociImage"
+)
+
+const (
+	// MediaTypeOctetStream is the default media type of file inputs whose media type cannot be detected.
+	MediaTypeOctetStream = "application/octet-stream"
+	// MediaTypeText is the default media type of text inputs.
+	MediaTypeText = "text/plain"
+	// gzipMediaTypeSuffix is appended to the media type of compressed blobs.
+	gzipMediaTypeSuffix = "+gzip"
+)
+
+// mediaTypes maps the lower case file extensions to the media types of file inputs.
+// The table is fixed so that the built component descriptor does not depend on the mime tables of the host.
+var mediaTypes = map[string]string{
+	".json": "application/json",
+	".yaml": "application/x-yaml",
+	".yml":  "application/x-yaml",
+	".xml":  "application/xml",
+	".txt":  MediaTypeText,
+	".md":   "text/markdown",
+	".html": "text/html",
+	".pem":  v2.MediaTypePEM,
+	".tar":  ctf.MediaTypeTar,
+	".tgz":  ctf.MediaTypeTarGzip,
+	".gz":   "application/gzip",
+	".zip":  "application/zip",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".svg":  "image/svg+xml",
+}
+
+// ComponentConstructor describes a component with its resources and sources
+// whose blobs are built from inputs.
+type ComponentConstructor struct {
+	v2.ObjectMeta `json:",inline"`
+	// Provider defines the provider type of the component.
+	Provider v2.ProviderType `json:"provider"`
+	// RepositoryContexts defines the previous repositories of the component.
+	RepositoryContexts []*v2.UnstructuredTypedObject `json:"repositoryContexts,omitempty"`
+	// ComponentReferences references component dependencies.
+	ComponentReferences []v2.ComponentReference `json:"componentReferences,omitempty"`
+	// Resources defines the resources of the component.
+	Resources []ResourceConstructor `json:"resources,omitempty"`
+	// Sources defines the sources of the component.
+	Sources []SourceConstructor `json:"sources,omitempty"`
+}
+
+// ResourceConstructor describes a resource whose blob is optionally built from an input.
+// Resources without input are added as they are.
+// Resources without version get the version of the component.
+type ResourceConstructor struct {
+	v2.Resource `json:",inline"`
+	// Input defines the input of the resource blob.
+	Input *Input `json:"input,omitempty"`
+}
+
+// SourceConstructor describes a source whose blob is optionally built from an input.
+// Sources without input are added as they are.
+// Sources without version get the version of the component.
+type SourceConstructor struct {
+	v2.Source `json:",inline"`
+	// Input defines the input of the source blob.
+	Input *Input `json:"input,omitempty"`
+}
+
+// Input describes how the blob of a resource or source is built.
+type Input struct {
+	// Type is the type of the input.
+	Type InputType `json:"type"`
+	// Path is the path of a file or directory input.
+	// Relative paths are resolved relative to the base directory of the constructor.
+	// The path of a directory input may also be a glob pattern.
+	Path string `json:"path,omitempty"`
+	// MediaType overwrites the detected media type of the blob.
+	MediaType string `json:"mediaType,omitempty"`
+	// Compress defines whether the blob is gzipped.
+	Compress bool `json:"compress,omitempty"`
+	// IncludeFiles are patterns of the files of a directory input that are included.
+	IncludeFiles []string `json:"includeFiles,omitempty"`
+	// ExcludeFiles are patterns of the files of a directory input that are excluded.
+	ExcludeFiles []string `json:"excludeFiles,omitempty"`
+	// Text is the content of a text input.
+	Text string `json:"text,omitempty"`
+	// ImageReference is the reference of an oci image input.
+	ImageReference string `json:"imageReference,omitempty"`
+}
+
+// Parse parses a component constructor from yaml or json.
+// Unknown fields are rejected.
+func Parse(data []byte) (*ComponentConstructor, error) {
+	constructor := &ComponentConstructor{}
+	if err := yaml.UnmarshalStrict(data, constructor); err != nil {
+		return nil, fmt.Errorf("unable to parse component constructor: %w", err)
+	}
+	return constructor, nil
+}
+
+// ReadFile reads and parses the component constructor at the given path.
+func ReadFile(fs vfs.FileSystem, path string) (*ComponentConstructor, error) {
+	data, err := vfs.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read component constructor %q: %w", path, err)
+	}
+	return Parse(data)
+}
+
+// BuildFile reads the component constructor at the given path and builds its component archive.
+// Relative input paths are resolved relative to the directory of the constructor file.
+func BuildFile(fs vfs.FileSystem, path string) (*ctf.ComponentArchive, error) {
+	constructor, err := ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	return constructor.Build(fs, vfs.Dir(fs, path))
+}
+
+// Build builds a component archive from the constructor.
+// The inputs are read from the given filesystem, relative paths are resolved relative to the base directory.
+// The digests and media types of all blobs are computed from their content.
+// The resulting component descriptor is defaulted and validated.
+func (c *ComponentConstructor) Build(fs vfs.FileSystem, baseDir string) (*ctf.ComponentArchive, error) {
+	cd := &v2.ComponentDescriptor{}
+	cd.Metadata.Version = v2.SchemaVersion
+	cd.ObjectMeta = c.ObjectMeta
+	cd.Provider = c.Provider
+	cd.RepositoryContexts = c.RepositoryContexts
+	cd.ComponentReferences = c.ComponentReferences
+	if err := v2.DefaultComponent(cd); err != nil {
+		return nil, err
+	}
+	ca := ctf.NewComponentArchive(cd, memoryfs.New())
+
+	for _, rc := range c.Resources {
+		res := rc.Resource
+		if err := c.addResource(ca, fs, baseDir, res, rc.Input); err != nil {
+			return nil, fmt.Errorf("unable to add resource %q: %w", res.GetName(), err)
+		}
+	}
+	for _, sc := range c.Sources {
+		src := sc.Source
+		if err := c.addSource(ca, fs, baseDir, src, sc.Input); err != nil {
+			return nil, fmt.Errorf("unable to add source %q: %w", src.GetName(), err)
+		}
+	}
+
+	if err := v2.DefaultComponent(cd); err != nil {
+		return nil, err
+	}
+	if err := validation.Validate(cd); err != nil {
+		return nil, fmt.Errorf("invalid component descriptor: %w", err)
+	}
+	return ca, nil
+}
+
+// AddToCTF builds the component archive and adds it to the ctf in the given format.
+// Previous archives of the same component are replaced.
+func (c *ComponentConstructor) AddToCTF(ctfArchive *ctf.CTF, fs vfs.FileSystem, baseDir string, format ctf.ArchiveFormat, opts ...ctf.WriteOption) (*ctf.ComponentArchive, error) {
+	ca, err := c.Build(fs, baseDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctfArchive.Replace(ca, format, opts...); err != nil {
+		return nil, fmt.Errorf("unable to add component archive to ctf: %w", err)
+	}
+	return ca, nil
+}
+
+// addResource adds a resource and the blob of its input to the component archive.
+func (c *ComponentConstructor) addResource(ca *ctf.ComponentArchive, fs vfs.FileSystem, baseDir string, res v2.Resource, input *Input) error {
+	if len(res.Version) == 0 {
+		res.Version = c.Version
+	}
+	if input == nil {
+		ca.ComponentDescriptor.Resources = append(ca.ComponentDescriptor.Resources, res)
+		return nil
+	}
+	if input.Type == OCIImageInputType {
+		if len(input.ImageReference) == 0 {
+			return errors.New("an image reference has to be defined")
+		}
+		if len(res.Type) == 0 {
+			res.Type = v2.OCIImageType
+		}
+		if len(res.Relation) == 0 {
+			res.Relation = v2.ExternalRelation
+		}
+		access, err := v2.NewUnstructured(v2.NewOCIRegistryAccess(input.ImageReference))
+		if err != nil {
+			return fmt.Errorf("unable to convert oci registry access to untructured type: %w", err)
+		}
+		res.Access = &access
+		ca.ComponentDescriptor.Resources = append(ca.ComponentDescriptor.Resources, res)
+		return nil
+	}
+
+	info, data, err := readInput(fs, baseDir, input)
+	if err != nil {
+		return err
+	}
+	if len(res.Relation) == 0 {
+		res.Relation = v2.LocalRelation
+	}
+	res.Digest = &v2.DigestSpec{
+		HashAlgorithm:          signatures.SHA256,
+		NormalisationAlgorithm: string(v2.GenericBlobDigestV1),
+		Value:                  digest.Digest(info.Digest).Encoded(),
+	}
+	return ca.AddResource(&res, *info, bytes.NewReader(data))
+}
+
+// addSource adds a source and the blob of its input to the component archive.
+func (c *ComponentConstructor) addSource(ca *ctf.ComponentArchive, fs vfs.FileSystem, baseDir string, src v2.Source, input *Input) error {
+	if len(src.Version) == 0 {
+		src.Version = c.Version
+	}
+	if input == nil {
+		ca.ComponentDescriptor.Sources = append(ca.ComponentDescriptor.Sources, src)
+		return nil
+	}
+	if input.Type == OCIImageInputType {
+		return fmt.Errorf("input type %q is not supported for sources", input.Type)
+	}
+	info, data, err := readInput(fs, baseDir, input)
+	if err != nil {
+		return err
+	}
+	return ca.AddSource(&src, *info, bytes.NewReader(data))
+}
+
+// readInput reads the blob of a file, directory or text input.
+func readInput(fs vfs.FileSystem, baseDir string, input *Input) (*ctf.BlobInfo, []byte, error) {
+	var (
+		data      []byte
+		mediaType string
+	)
+	switch input.Type {
+	case FileInputType:
+		if len(input.Path) == 0 {
+			return nil, nil, errors.New("a path has to be defined")
+		}
+		var err error
+		data, err = vfs.ReadFile(fs, inputPath(fs, baseDir, input.Path))
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read file input: %w", err)
+		}
+		mediaType = detectMediaType(input.Path)
+	case TextInputType:
+		data = []byte(input.Text)
+		mediaType = MediaTypeText
+	case DirectoryInputType:
+		if len(input.Path) == 0 {
+			return nil, nil, errors.New("a path has to be defined")
+		}
+		opts := ctf.DirectoryOptions{
+			Format:          ctf.ArchiveFormatTar,
+			IncludePatterns: input.IncludeFiles,
+			ExcludePatterns: input.ExcludeFiles,
+		}
+		mediaType = ctf.MediaTypeTar
+		if input.Compress {
+			opts.Format = ctf.ArchiveFormatTarGzip
+			mediaType = ctf.MediaTypeTarGzip
+		}
+		var buf bytes.Buffer
+		if err := ctf.WriteDirectory(&buf, fs, inputPath(fs, baseDir, input.Path), opts); err != nil {
+			return nil, nil, fmt.Errorf("unable to pack directory input: %w", err)
+		}
+		data = buf.Bytes()
+		if len(input.MediaType) != 0 {
+			mediaType = input.MediaType
+		}
+		return newBlobInfo(mediaType, data), data, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported input type %q", input.Type)
+	}
+
+	if len(input.MediaType) != 0 {
+		mediaType = input.MediaType
+	}
+	if input.Compress {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		if _, err := gw.Write(data); err != nil {
+			return nil, nil, fmt.Errorf("unable to compress input: %w", err)
+		}
+		if err := gw.Close(); err != nil {
+			return nil, nil, fmt.Errorf("unable to compress input: %w", err)
+		}
+		data = buf.Bytes()
+		mediaType += gzipMediaTypeSuffix
+	}
+	return newBlobInfo(mediaType, data), data, nil
+}
+
+// inputPath resolves the path of an input relative to the base directory.
+func inputPath(fs vfs.FileSystem, baseDir, path string) string {
+	if vfs.IsAbs(fs, path) {
+		return path
+	}
+	return vfs.Join(fs, baseDir, path)
+}
+
+// detectMediaType detects the media type of a file from its extension.
+// Files with unknown extensions are of type MediaTypeOctetStream.
+func detectMediaType(path string) string {
+	mediaType, ok := mediaTypes[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return MediaTypeOctetStream
+	}
+	return mediaType
+}
+
+func newBlobInfo(mediaType string, data []byte) *ctf.BlobInfo {
+	return &ctf.BlobInfo{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data).String(),
+		Size:      int64(len(data)),
+	}
+}
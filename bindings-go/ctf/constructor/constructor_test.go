@@ -0,0 +1,209 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package constructor_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/mandelsoft/vfs/pkg/memoryfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+	"github.com/gardener/component-spec/bindings-go/ctf/constructor"
+)
+
+const testConstructor = `
+name: example.com/a
+version: 1.0.0
+provider: internal
+componentReferences:
+- name: component-b
+  componentName: example.com/b
+  version: 2.0.0
+resources:
+- name: config
+  type: json
+  input:
+    type: file
+    path: config.json
+- name: chart
+  type: helm
+  input:
+    type: dir
+    path: chart
+    compress: true
+    excludeFiles:
+    - "*.tmp"
+- name: notes
+  type: plaintext
+  input:
+    type: text
+    text: some notes
+    compress: true
+- name: image
+  input:
+    type: ociImage
+    imageReference: example.com/image:1.0.0
+sources:
+- name: repo
+  type: git
+  input:
+    type: dir
+    path: chart
+`
+
+var _ = Describe("Constructor", func() {
+
+	var fs vfs.FileSystem
+
+	BeforeEach(func() {
+		fs = memoryfs.New()
+		Expect(fs.MkdirAll("/component/chart", os.ModePerm)).To(Succeed())
+		Expect(vfs.WriteFile(fs, "/component/constructor.yaml", []byte(testConstructor), os.ModePerm)).To(Succeed())
+		Expect(vfs.WriteFile(fs, "/component/config.json", []byte(`{"a": 1}`), os.ModePerm)).To(Succeed())
+		Expect(vfs.WriteFile(fs, "/component/chart/Chart.yaml", []byte("name: chart"), os.ModePerm)).To(Succeed())
+		Expect(vfs.WriteFile(fs, "/component/chart/build.tmp", []byte("tmp"), os.ModePerm)).To(Succeed())
+	})
+
+	It("should build a component archive from inputs", func() {
+		ctx := context.Background()
+		ca, err := constructor.BuildFile(fs, "/component/constructor.yaml")
+		Expect(err).ToNot(HaveOccurred())
+		cd := ca.ComponentDescriptor
+		Expect(cd.GetName()).To(Equal("example.com/a"))
+		Expect(cd.ComponentReferences).To(HaveLen(1))
+		Expect(cd.Resources).To(HaveLen(4))
+
+		config, err := cd.GetResourcesByName("config")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config).To(HaveLen(1))
+		Expect(config[0].Version).To(Equal("1.0.0"))
+		Expect(config[0].Relation).To(Equal(cdv2.LocalRelation))
+		Expect(config[0].Digest.Value).To(Equal(digest.FromString(`{"a": 1}`).Encoded()))
+		var blob bytes.Buffer
+		info, err := ca.Resolve(ctx, config[0], &blob)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.MediaType).To(Equal("application/json"))
+		Expect(blob.String()).To(Equal(`{"a": 1}`))
+
+		notes, err := cd.GetResourcesByName("notes")
+		Expect(err).ToNot(HaveOccurred())
+		blob.Reset()
+		info, err = ca.Resolve(ctx, notes[0], &blob)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.MediaType).To(Equal(constructor.MediaTypeText + "+gzip"))
+		gr, err := gzip.NewReader(&blob)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.ReadAll(gr)).To(Equal([]byte("some notes")))
+
+		chart, err := cd.GetResourcesByName("chart")
+		Expect(err).ToNot(HaveOccurred())
+		out := memoryfs.New()
+		Expect(ctf.ExtractDirectoryBlob(ctx, ca, chart[0], out, "/out")).To(Succeed())
+		Expect(vfs.FileExists(out, "/out/Chart.yaml")).To(BeTrue())
+		Expect(vfs.Exists(out, "/out/build.tmp")).To(BeFalse())
+
+		image, err := cd.GetResourcesByName("image")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(image[0].Type).To(Equal(cdv2.OCIImageType))
+		Expect(image[0].Relation).To(Equal(cdv2.ExternalRelation))
+		Expect(image[0].Access.GetType()).To(Equal(cdv2.OCIRegistryType))
+
+		Expect(cd.Sources).To(HaveLen(1))
+		blob.Reset()
+		info, err = ca.ResolveSource(ctx, cd.Sources[0], &blob)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.MediaType).To(Equal(ctf.MediaTypeTar))
+	})
+
+	It("should detect media types independent of the host and default the versions of all resources", func() {
+		Expect(vfs.WriteFile(fs, "/component/values.YAML", []byte("a: 1"), os.ModePerm)).To(Succeed())
+		Expect(vfs.WriteFile(fs, "/component/data.unknown", []byte("data"), os.ModePerm)).To(Succeed())
+		c, err := constructor.Parse([]byte(`
+name: example.com/a
+version: 1.0.0
+provider: internal
+resources:
+- name: image
+  type: ociImage
+  relation: external
+  access:
+    type: ociRegistry
+    imageReference: example.com/image:1.0.0
+- name: values
+  type: yaml
+  input:
+    type: file
+    path: values.YAML
+- name: data
+  type: blob
+  input:
+    type: file
+    path: data.unknown
+`))
+		Expect(err).ToNot(HaveOccurred())
+		ca, err := c.Build(fs, "/component")
+		Expect(err).ToNot(HaveOccurred())
+		cd := ca.ComponentDescriptor
+		Expect(cd.Resources).To(HaveLen(3))
+		for _, res := range cd.Resources {
+			Expect(res.Version).To(Equal("1.0.0"), res.GetName())
+		}
+		info, err := ca.Info(context.Background(), cd.Resources[1])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.MediaType).To(Equal("application/x-yaml"))
+		info, err = ca.Info(context.Background(), cd.Resources[2])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.MediaType).To(Equal(constructor.MediaTypeOctetStream))
+	})
+
+	It("should add the built component archive to a ctf", func() {
+		c, err := constructor.ReadFile(fs, "/component/constructor.yaml")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vfs.WriteFile(fs, "/ctf.tar", []byte{}, os.ModePerm)).To(Succeed())
+		ctfArchive, err := ctf.NewCTF(fs, "/ctf.tar")
+		Expect(err).ToNot(HaveOccurred())
+		defer ctfArchive.Close()
+
+		_, err = c.AddToCTF(ctfArchive, fs, "/component", ctf.ArchiveFormatTar)
+		Expect(err).ToNot(HaveOccurred())
+		// building twice results in the same archive.
+		_, err = c.AddToCTF(ctfArchive, fs, "/component", ctf.ArchiveFormatTar)
+		Expect(err).ToNot(HaveOccurred())
+		list, err := ctfArchive.List()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Name).To(Equal("example.com/a"))
+	})
+
+	It("should reject unknown fields and invalid inputs", func() {
+		_, err := constructor.Parse([]byte("name: example.com/a\nversion: 1.0.0\nunknown: true\n"))
+		Expect(err).To(HaveOccurred())
+
+		c, err := constructor.Parse([]byte(`
+name: example.com/a
+version: 1.0.0
+provider: internal
+resources:
+- name: missing
+  type: json
+  input:
+    type: file
+    path: missing.json
+`))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = c.Build(fs, "/component")
+		Expect(err).To(HaveOccurred())
+	})
+
+})
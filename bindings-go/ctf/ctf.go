@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/mandelsoft/vfs/pkg/projectionfs"
 	"github.com/mandelsoft/vfs/pkg/vfs"
@@ -46,6 +48,9 @@ var NotFoundError = errors.New("ComponentDescriptorNotFound")
 
 var BlobResolverNotDefinedError = errors.New("BlobResolverNotDefined")
 
+// DuplicateComponentError is returned if a component is contained multiple times in a ctf.
+var DuplicateComponentError = errors.New("DuplicateComponent")
+
 // ComponentResolver describes a general interface to resolve a component descriptor
 type ComponentResolver interface {
 	Resolve(ctx context.Context, repoCtx v2.Repository, name, version string) (*v2.ComponentDescriptor, error)
@@ -68,6 +73,22 @@ type TypedBlobResolver interface {
 	CanResolve(resource v2.Resource) bool
 }
 
+// SourceBlobResolver defines a blob resolver
+// that is also able to fetch the blobs of sources.
+type SourceBlobResolver interface {
+	InfoSource(ctx context.Context, src v2.Source) (*BlobInfo, error)
+	ResolveSource(ctx context.Context, src v2.Source, writer io.Writer) (*BlobInfo, error)
+}
+
+// sourceResource returns a resource with the identity and the access of the source,
+// so that the blob of the source can be resolved like the blob of a resource.
+func sourceResource(src v2.Source) v2.Resource {
+	return v2.Resource{
+		IdentityObjectMeta: src.IdentityObjectMeta,
+		Access:             src.Access,
+	}
+}
+
 // BlobInfo describes a blob.
 type BlobInfo struct {
 	// MediaType is the media type of the object this schema refers to.
@@ -81,13 +102,15 @@ type BlobInfo struct {
 }
 
 // ArchiveFormat describes the format of a component archive.
-// A archive can currently be defined in a filesystem, as tar or as gzipped tar.
+// A archive can currently be defined in a filesystem, as tar, as gzipped tar or as zstd compressed tar.
+// Filesystem archives are stored as directories in a ctf.
 type ArchiveFormat string
 
 const (
 	ArchiveFormatFilesystem ArchiveFormat = "fs"
 	ArchiveFormatTar        ArchiveFormat = "tar"
 	ArchiveFormatTarGzip    ArchiveFormat = "tgz"
+	ArchiveFormatTarZstd    ArchiveFormat = "tzst"
 )
 
 type CTF struct {
@@ -95,11 +118,25 @@ type CTF struct {
 	ctfPath string
 	tempDir string
 	tempFs vfs.FileSystem
+	// isDirectory defines whether the ctf is a directory that is directly modified.
+	isDirectory bool
+	// extractOpts are the options that are used to extract the ctf and its component archives.
+	extractOpts []ExtractOption
 }
 
-// NewCTF reads a CTF archive from a file.
+// NewCTF reads a CTF archive from a file or a directory.
+// A directory is used as it is, whereas a file is extracted to a temporary directory.
+// The extract options limit the extracted content of the ctf and of its component archives.
 // The use should call "Close" to remove all temporary files
-func NewCTF(fs vfs.FileSystem, ctfPath string) (*CTF, error) {
+func NewCTF(fs vfs.FileSystem, ctfPath string, opts ...ExtractOption) (*CTF, error) {
+	isDir, err := vfs.DirExists(fs, ctfPath)
+	if err != nil {
+		return nil, err
+	}
+	if isDir {
+		return newCTFFromDirectory(fs, ctfPath, opts...)
+	}
+
 	tempDir, err := vfs.TempDir(fs, "", "ctf-")
 	if err != nil {
 		return nil, err
@@ -110,74 +147,425 @@ func NewCTF(fs vfs.FileSystem, ctfPath string) (*CTF, error) {
 	}
 
 	ctf := &CTF{
-		fs:      fs,
-		ctfPath: ctfPath,
-		tempDir: tempDir,
-		tempFs:  tempFs,
+		fs:          fs,
+		ctfPath:     ctfPath,
+		tempDir:     tempDir,
+		tempFs:      tempFs,
+		extractOpts: opts,
 	}
 	if err := ctf.extract(); err != nil {
+		_ = fs.RemoveAll(tempDir)
 		return nil, fmt.Errorf("unable to read ctf: %w", err)
 	}
 	return ctf, nil
 }
 
+// newCTFFromDirectory creates a ctf that is backed by a directory.
+func newCTFFromDirectory(fs vfs.FileSystem, ctfPath string, opts ...ExtractOption) (*CTF, error) {
+	ctfFs, err := projectionfs.New(fs, ctfPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create fs for ctf directory %q: %w", ctfPath, err)
+	}
+	return &CTF{
+		fs:          fs,
+		ctfPath:     ctfPath,
+		tempFs:      ctfFs,
+		isDirectory: true,
+		extractOpts: opts,
+	}, nil
+}
+
 type WalkFunc = func(ca *ComponentArchive) error
 
 // Walk traverses through all component archives that are included in the ctf.
 func (ctf *CTF) Walk(walkFunc WalkFunc) error {
-	err := vfs.Walk(ctf.tempFs, "/", func(path string, info os.FileInfo, err error) error {
+	return ctf.walk(func(_ string, ca *ComponentArchive) error {
+		return walkFunc(ca)
+	})
+}
+
+// walk traverses through all component archives that are included in the ctf
+// and calls the walk function with the path of the archive within the ctf.
+func (ctf *CTF) walk(walkFunc func(path string, ca *ComponentArchive) error) error {
+	paths, err := ctf.archivePaths("/")
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		ca, err := ctf.readComponentArchive(path)
 		if err != nil {
 			return err
 		}
+		if err := walkFunc(path, ca); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archivePaths returns the paths of all component archives in the given directory of the ctf.
+// Directories that contain a component descriptor are filesystem component archives
+// and files are only component archives if they are tar archives.
+func (ctf *CTF) archivePaths(dir string) ([]string, error) {
+	infos, err := vfs.ReadDir(ctf.tempFs, dir)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(infos))
+	for _, info := range infos {
+		path := vfs.Join(ctf.tempFs, dir, info.Name())
+		if path == "/"+BlobsDirectoryName {
+			// the shared blob directory does not contain component archives.
+			continue
+		}
 		if info.IsDir() {
-			return nil
+			isArchive, err := vfs.FileExists(ctf.tempFs, vfs.Join(ctf.tempFs, path, ComponentDescriptorFileName))
+			if err != nil {
+				return nil, err
+			}
+			if !isArchive {
+				subPaths, err := ctf.archivePaths(path)
+				if err != nil {
+					return nil, err
+				}
+				paths = append(paths, subPaths...)
+				continue
+			}
+		} else {
+			isArchive, err := ctf.isTarArchive(path)
+			if err != nil {
+				return nil, err
+			}
+			if !isArchive {
+				// other files like readmes or lock files are no component archives.
+				continue
+			}
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// isTarArchive checks whether the file at the given path of the ctf is a tar archive
+// that is optionally compressed with gzip or zstd.
+func (ctf *CTF) isTarArchive(path string) (bool, error) {
+	file, err := ctf.tempFs.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("unable to read %q: %w", path, err)
+	}
+	defer file.Close()
+	reader, _, err := NewDecompressingReader(file)
+	if err != nil {
+		return false, nil
+	}
+	defer reader.Close()
+	if _, err := tar.NewReader(reader).Next(); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// ReadComponentArchive reads the component archive at the given path of the ctf
+// as it is returned by List.
+func (ctf *CTF) ReadComponentArchive(path string) (*ComponentArchive, error) {
+	return ctf.readComponentArchive("/" + strings.TrimPrefix(path, "/"))
+}
+
+// readComponentArchive reads the component archive at the given path of the ctf.
+// Blobs that are only contained in the shared blob directory are read from the ctf when they are resolved
+// or the component archive is written.
+// Changes of filesystem component archives are directly written to the ctf.
+func (ctf *CTF) readComponentArchive(path string) (*ComponentArchive, error) {
+	layout, err := ctf.BlobLayout()
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ctf.openComponentArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	if layout == BlobLayoutShared {
+		ca.withSharedBlobs(ctf.openSharedBlob)
+	}
+	return ca, nil
+}
+
+// openComponentArchive opens the component archive at the given path of the ctf.
+func (ctf *CTF) openComponentArchive(path string) (*ComponentArchive, error) {
+	isDir, err := vfs.DirExists(ctf.tempFs, path)
+	if err != nil {
+		return nil, err
+	}
+	if isDir {
+		caFs, err := projectionfs.New(ctf.tempFs, path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create fs for component archive %q: %w", path, err)
 		}
+		return NewComponentArchiveFromFilesystem(caFs)
+	}
+
+	file, err := ctf.tempFs.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read component archive file %q: %w", path, err)
+	}
+	defer file.Close()
+	ca, err := NewComponentArchiveFromCompressedTarReader(file, ctf.extractOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read component archive file %q: %w", path, err)
+	}
+	return ca, nil
+}
+
+// ComponentArchiveInfo describes a component archive of a ctf.
+type ComponentArchiveInfo struct {
+	// Name is the name of the component.
+	Name string
+	// Version is the version of the component.
+	Version string
+	// Digest is the digest of the component descriptor as computed by ComponentArchive.Digest.
+	Digest string
+	// Path is the path of the component archive within the ctf.
+	Path string
+}
 
-		file, err := ctf.tempFs.Open(path)
+// List returns all component archives that are included in the ctf.
+// Only the component descriptors of the archives are read.
+func (ctf *CTF) List() ([]ComponentArchiveInfo, error) {
+	paths, err := ctf.archivePaths("/")
+	if err != nil {
+		return nil, err
+	}
+	list := make([]ComponentArchiveInfo, 0, len(paths))
+	for _, path := range paths {
+		cd, err := ctf.readComponentDescriptor(path)
 		if err != nil {
-			return fmt.Errorf("unable to read component archive file %q: %w", path, err)
+			return nil, err
 		}
-		ca, err := NewComponentArchiveFromTarReader(file)
+		dig, err := (&ComponentArchive{ComponentDescriptor: cd}).Digest()
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("unable to compute digest of %q: %w", path, err)
 		}
+		list = append(list, ComponentArchiveInfo{
+			Name:    cd.GetName(),
+			Version: cd.GetVersion(),
+			Digest:  dig,
+			Path:    strings.TrimPrefix(path, "/"),
+		})
+	}
+	return list, nil
+}
 
-		return walkFunc(ca)
-	})
-	return err
+// readComponentDescriptor reads only the component descriptor of the component archive at the given path of the ctf.
+// Tar archives are read up to their component descriptor.
+func (ctf *CTF) readComponentDescriptor(path string) (*v2.ComponentDescriptor, error) {
+	isDir, err := vfs.DirExists(ctf.tempFs, path)
+	if err != nil {
+		return nil, err
+	}
+	if isDir {
+		file, err := ctf.tempFs.Open(vfs.Join(ctf.tempFs, path, ComponentDescriptorFileName))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read component descriptor of %q: %w", path, err)
+		}
+		defer file.Close()
+		cd, err := decodeComponentDescriptor(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read component archive %q: %w", path, err)
+		}
+		return cd, nil
+	}
+
+	file, err := ctf.tempFs.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read component archive file %q: %w", path, err)
+	}
+	defer file.Close()
+	reader, _, err := NewDecompressingReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read component archive file %q: %w", path, err)
+	}
+	defer reader.Close()
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("unable to read component archive file %q: no %s found", path, ComponentDescriptorFileName)
+			}
+			return nil, fmt.Errorf("unable to read component archive file %q: %w", path, err)
+		}
+		if header.Typeflag != tar.TypeReg || cleanTarPath(header.Name) != cleanTarPath(ComponentDescriptorFileName) {
+			continue
+		}
+		cd, err := decodeComponentDescriptor(tr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read component archive file %q: %w", path, err)
+		}
+		return cd, nil
+	}
+}
+
+// find returns the paths of all component archives of the given component.
+func (ctf *CTF) find(name, version string) ([]string, error) {
+	list, err := ctf.List()
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0)
+	for _, info := range list {
+		if info.Name == name && info.Version == version {
+			paths = append(paths, info.Path)
+		}
+	}
+	return paths, nil
+}
+
+// Remove removes the component archive of the given component from the ctf.
+// A NotFoundError is returned if the ctf does not contain the component.
+// Shared blobs that are no longer referenced by any component archive are removed.
+func (ctf *CTF) Remove(name, version string) error {
+	paths, err := ctf.find(name, version)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return NotFoundError
+	}
+	for _, path := range paths {
+		if err := ctf.tempFs.RemoveAll(path); err != nil {
+			return fmt.Errorf("unable to remove component archive %q: %w", path, err)
+		}
+	}
+	return ctf.pruneSharedBlobs()
+}
+
+// Replace adds the component archive to the ctf and removes all other archives of the same component.
+// The previous archives are only removed after the new archive has been successfully added.
+func (ctf *CTF) Replace(ca *ComponentArchive, format ArchiveFormat, opts ...WriteOption) error {
+	filename, err := ca.Digest()
+	if err != nil {
+		return err
+	}
+	return ctf.ReplaceWithName(filename, ca, format, opts...)
+}
+
+// ReplaceWithName adds the component archive to the ctf with the given name
+// and removes all other archives of the same component.
+// The previous archives are only removed after the new archive has been successfully added.
+// Shared blobs that are no longer referenced by any component archive are removed.
+func (ctf *CTF) ReplaceWithName(filename string, ca *ComponentArchive, format ArchiveFormat, opts ...WriteOption) error {
+	paths, err := ctf.find(ca.ComponentDescriptor.GetName(), ca.ComponentDescriptor.GetVersion())
+	if err != nil {
+		return err
+	}
+	if err := ctf.replaceWithName(filename, ca, format, paths, opts...); err != nil {
+		return err
+	}
+	return ctf.pruneSharedBlobs()
+}
+
+// replaceWithName adds the component archive to the ctf with the given name
+// and afterwards removes the previous archives at the given paths.
+func (ctf *CTF) replaceWithName(filename string, ca *ComponentArchive, format ArchiveFormat, previous []string, opts ...WriteOption) error {
+	if err := ctf.AddComponentArchiveWithName(filename, ca, format, opts...); err != nil {
+		return err
+	}
+	for _, path := range previous {
+		if vfs.Join(ctf.tempFs, "/", path) == vfs.Join(ctf.tempFs, "/", filename) {
+			continue
+		}
+		if err := ctf.tempFs.RemoveAll(path); err != nil {
+			return fmt.Errorf("unable to remove previous component archive %q: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// checkDuplicates returns a DuplicateComponentError if a component is contained multiple times in the ctf.
+func (ctf *CTF) checkDuplicates() error {
+	list, err := ctf.List()
+	if err != nil {
+		return err
+	}
+	paths := map[componentKey]string{}
+	for _, info := range list {
+		key := componentKey{Name: info.Name, Version: info.Version}
+		if existing, ok := paths[key]; ok {
+			return fmt.Errorf("%w: component %q in version %q is contained in %q and %q", DuplicateComponentError, key.Name, key.Version, existing, info.Path)
+		}
+		paths[key] = info.Path
+	}
+	return nil
 }
 
 // AddComponentArchive adds or updates a component archive in the ctf archive.
-func (ctf *CTF) AddComponentArchive(ca *ComponentArchive, format ArchiveFormat) error {
+func (ctf *CTF) AddComponentArchive(ca *ComponentArchive, format ArchiveFormat, opts ...WriteOption) error {
 	filename, err := ca.Digest()
 	if err != nil {
 		return err
 	}
-	return ctf.AddComponentArchiveWithName(filename, ca, format)
+	return ctf.AddComponentArchiveWithName(filename, ca, format, opts...)
 }
 
 // AddComponentArchiveWithName adds or updates a component archive in the ctf archive.
-// The archive is added to the ctf with the given name
-func (ctf *CTF) AddComponentArchiveWithName(filename string, ca *ComponentArchive, format ArchiveFormat) error {
-	file, err := ctf.tempFs.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+// The archive is added to the ctf with the given name.
+// If the ctf uses the shared blob layout, all blobs that are named by their digest are added to the shared blob directory.
+func (ctf *CTF) AddComponentArchiveWithName(filename string, ca *ComponentArchive, format ArchiveFormat, opts ...WriteOption) error {
+	layout, err := ctf.BlobLayout()
+	if err != nil {
+		return err
+	}
+	return ctf.addComponentArchiveWithName(filename, ca, format, layout, opts...)
+}
+
+// addComponentArchiveWithName adds or updates a component archive in the ctf archive using the given blob layout.
+func (ctf *CTF) addComponentArchiveWithName(filename string, ca *ComponentArchive, format ArchiveFormat, layout BlobLayout, opts ...WriteOption) error {
+	if layout == BlobLayoutShared {
+		var err error
+		ca, err = ctf.shareBlobs(ca)
+		if err != nil {
+			return fmt.Errorf("unable to share blobs of %q: %w", filename, err)
+		}
+	}
+	if err := ctf.tempFs.MkdirAll(vfs.Dir(ctf.tempFs, filename), os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create directory for %q: %w", filename, err)
+	}
+	// the archive is written to a temporary path first,
+	// as the component archive might be read from the path that is replaced.
+	tempPath := vfs.Join(ctf.tempFs, "/", vfs.Dir(ctf.tempFs, filename), "."+vfs.Base(ctf.tempFs, filename)+".tmp")
+	if err := writeComponentArchive(ctf.tempFs, tempPath, ca, format, opts...); err != nil {
+		_ = ctf.tempFs.RemoveAll(tempPath)
+		return fmt.Errorf("unable to write component archive to %q: %w", filename, err)
+	}
+	if err := ctf.tempFs.RemoveAll(filename); err != nil && !vfs.IsErrNotExist(err) {
+		return fmt.Errorf("unable to remove previous component archive %q: %w", filename, err)
+	}
+	return ctf.tempFs.Rename(tempPath, filename)
+}
+
+// writeComponentArchive writes the component archive in the given format to the path.
+func writeComponentArchive(fs vfs.FileSystem, path string, ca *ComponentArchive, format ArchiveFormat, opts ...WriteOption) error {
+	if format == ArchiveFormatFilesystem {
+		return ca.WriteToFilesystem(fs, path)
+	}
+	file, err := fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return err
 	}
 	switch format {
 	case ArchiveFormatTar:
-		if err := ca.WriteTar(file); err != nil {
-			_ = file.Close()
-			return fmt.Errorf("unable to write component archive to %q: %w", filename, err)
-		}
+		err = ca.WriteTar(file, opts...)
 	case ArchiveFormatTarGzip:
-		if err := ca.WriteTarGzip(file); err != nil {
-			_ = file.Close()
-			return fmt.Errorf("unable to write component archive to %q: %w", filename, err)
-		}
+		err = ca.WriteTarGzip(file, opts...)
+	case ArchiveFormatTarZstd:
+		err = ca.WriteTarZstd(file, opts...)
 	default:
-		return fmt.Errorf("unsupported archive format %q", format)
+		err = fmt.Errorf("unsupported archive format %q", format)
+	}
+	if err != nil {
+		_ = file.Close()
+		return err
 	}
-
 	return file.Close()
 }
 
@@ -188,33 +576,58 @@ func (ctf *CTF) extract() error {
 		return err
 	}
 	defer file.Close()
-	return ExtractTarToFs(ctf.tempFs, file)
+	return ExtractTarToFs(ctf.tempFs, file, ctf.extractOpts...)
 }
 
 // Write writes the current changes back to the original ctf.
-func (ctf *CTF) Write() error {
+// Changes of a ctf directory are directly applied, so nothing has to be written.
+// A DuplicateComponentError is returned if a component is contained multiple times.
+// Shared blobs that are not referenced by any component archive are removed before writing.
+func (ctf *CTF) Write(opts ...WriteOption) error {
+	if err := ctf.checkDuplicates(); err != nil {
+		return err
+	}
+	if err := ctf.pruneSharedBlobs(); err != nil {
+		return err
+	}
+	if ctf.isDirectory {
+		return nil
+	}
 	file, err := ctf.fs.OpenFile(ctf.ctfPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	tw := tar.NewWriter(file)
-	defer tw.Close()
+	if err := ctf.WriteTar(file, opts...); err != nil {
+		return err
+	}
+	return file.Close()
+}
 
-	err = vfs.Walk(ctf.tempFs, "/", func(path string, info os.FileInfo, err error) error {
+// WriteTar writes the ctf as tar to the given writer.
+// The entries are written sorted by their path.
+func (ctf *CTF) WriteTar(writer io.Writer, opts ...WriteOption) error {
+	options := (&WriteOptions{}).ApplyOptions(opts)
+	tw := tar.NewWriter(writer)
+	err := vfs.Walk(ctf.tempFs, "/", func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
+		if path == "/" {
 			return nil
 		}
 		header, err := tar.FileInfoHeader(info, "")
 		if err != nil {
 			return err
 		}
+		header.Name = strings.TrimPrefix(filepath.ToSlash(path), "/")
+		options.normalizeHeader(header)
 		if err := tw.WriteHeader(header); err != nil {
 			return fmt.Errorf("unable to write header for %q: %w", path, err)
 		}
+		if info.IsDir() {
+			return nil
+		}
 
 		blob, err := ctf.tempFs.Open(path)
 		if err != nil {
@@ -226,11 +639,26 @@ func (ctf *CTF) Write() error {
 		}
 		return nil
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// WriteToFilesystem writes the ctf as directory to the given path of the filesystem.
+// The resulting directory can again be read with NewCTF.
+func (ctf *CTF) WriteToFilesystem(fs vfs.FileSystem, path string) error {
+	if err := vfs.CopyDir(ctf.tempFs, "/", fs, path); err != nil {
+		return fmt.Errorf("unable to write ctf to %q: %w", path, err)
+	}
+	return nil
 }
 
 // Close closes the CTF that deletes all temporary files
 func (ctf *CTF) Close() error {
+	if ctf.isDirectory {
+		return nil
+	}
 	return ctf.fs.RemoveAll(ctf.tempDir)
 }
 
@@ -242,6 +670,7 @@ type AggregatedBlobResolver struct {
 }
 
 var _ BlobResolver = &AggregatedBlobResolver{}
+var _ SourceBlobResolver = &AggregatedBlobResolver{}
 
 // NewAggregatedBlobResolver creates a new aggregated resolver.
 // Note that only typed resolvers can be added.
@@ -286,6 +715,38 @@ func (a *AggregatedBlobResolver) Resolve(ctx context.Context, res v2.Resource, w
 	return resolver.Resolve(ctx, res, writer)
 }
 
+// InfoSource returns the blob info of a source.
+// UnsupportedResolveType is returned if the matching resolver cannot resolve sources.
+func (a *AggregatedBlobResolver) InfoSource(ctx context.Context, src v2.Source) (*BlobInfo, error) {
+	resolver, err := a.getSourceResolver(src)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.InfoSource(ctx, src)
+}
+
+// ResolveSource fetches the blob of a source.
+// UnsupportedResolveType is returned if the matching resolver cannot resolve sources.
+func (a *AggregatedBlobResolver) ResolveSource(ctx context.Context, src v2.Source, writer io.Writer) (*BlobInfo, error) {
+	resolver, err := a.getSourceResolver(src)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.ResolveSource(ctx, src, writer)
+}
+
+func (a *AggregatedBlobResolver) getSourceResolver(src v2.Source) (SourceBlobResolver, error) {
+	resolver, err := a.getResolver(sourceResource(src))
+	if err != nil {
+		return nil, err
+	}
+	sourceResolver, ok := resolver.(SourceBlobResolver)
+	if !ok {
+		return nil, UnsupportedResolveType
+	}
+	return sourceResolver, nil
+}
+
 func (a *AggregatedBlobResolver) getResolver(res v2.Resource) (BlobResolver, error) {
 	if res.Access == nil {
 		return nil, fmt.Errorf("no access is defined")
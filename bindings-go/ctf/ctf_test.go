@@ -0,0 +1,657 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mandelsoft/vfs/pkg/memoryfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/gardener/component-spec/bindings-go/ctf"
+)
+
+var _ = Describe("CTF", func() {
+
+	Context("Filesystem", func() {
+
+		It("should read and write a ctf directory", func() {
+			fs := memoryfs.New()
+			Expect(fs.MkdirAll("/ctf", os.ModePerm)).To(Succeed())
+			ctfArchive, err := ctf.NewCTF(fs, "/ctf")
+			Expect(err).ToNot(HaveOccurred())
+
+			a := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a, "res", []byte("blob a"))
+			Expect(ctfArchive.AddComponentArchiveWithName("a", a, ctf.ArchiveFormatFilesystem)).To(Succeed())
+			Expect(ctfArchive.AddComponentArchiveWithName("b.tar", newTestComponentArchive("example.com/b", "0.0.0"), ctf.ArchiveFormatTar)).To(Succeed())
+			Expect(ctfArchive.Write()).To(Succeed())
+			Expect(ctfArchive.Close()).To(Succeed())
+
+			// changes are directly written to the directory.
+			Expect(vfs.FileExists(fs, "/ctf/a/component-descriptor.yaml")).To(BeTrue())
+			Expect(vfs.FileExists(fs, "/ctf/b.tar")).To(BeTrue())
+
+			ctfArchive, err = ctf.NewCTF(fs, "/ctf")
+			Expect(err).ToNot(HaveOccurred())
+			defer ctfArchive.Close()
+			expectComponents(ctfArchive, "example.com/a", "example.com/b")
+
+			resolver, err := ctf.NewCTFResolver(ctfArchive)
+			Expect(err).ToNot(HaveOccurred())
+			cd, blobResolver, err := resolver.ResolveWithBlobResolver(context.Background(), nil, "example.com/a", "0.0.0")
+			Expect(err).ToNot(HaveOccurred())
+			var blob bytes.Buffer
+			_, err = blobResolver.Resolve(context.Background(), cd.Resources[0], &blob)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(blob.String()).To(Equal("blob a"))
+		})
+
+		It("should ignore files that are no component archives", func() {
+			fs := memoryfs.New()
+			Expect(fs.MkdirAll("/ctf", os.ModePerm)).To(Succeed())
+			ctfArchive, err := ctf.NewCTF(fs, "/ctf")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ctfArchive.AddComponentArchiveWithName("a.tgz", newTestComponentArchive("example.com/a", "0.0.0"), ctf.ArchiveFormatTarGzip)).To(Succeed())
+			Expect(ctfArchive.Close()).To(Succeed())
+
+			Expect(vfs.WriteFile(fs, "/ctf/README.md", []byte("# components"), os.ModePerm)).To(Succeed())
+			Expect(vfs.WriteFile(fs, "/ctf/.lock", nil, os.ModePerm)).To(Succeed())
+			var gzipped bytes.Buffer
+			gw := gzip.NewWriter(&gzipped)
+			_, err = gw.Write([]byte("no tar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gw.Close()).To(Succeed())
+			Expect(vfs.WriteFile(fs, "/ctf/notes.gz", gzipped.Bytes(), os.ModePerm)).To(Succeed())
+
+			ctfArchive, err = ctf.NewCTF(fs, "/ctf")
+			Expect(err).ToNot(HaveOccurred())
+			defer ctfArchive.Close()
+			list, err := ctfArchive.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(list).To(HaveLen(1))
+			Expect(list[0].Path).To(Equal("a.tgz"))
+			expectComponents(ctfArchive, "example.com/a")
+			_, err = ctf.NewCTFResolver(ctfArchive)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should replace a component archive with an archive of another format", func() {
+			fs := memoryfs.New()
+			Expect(fs.MkdirAll("/ctf", os.ModePerm)).To(Succeed())
+			ctfArchive, err := ctf.NewCTF(fs, "/ctf")
+			Expect(err).ToNot(HaveOccurred())
+			defer ctfArchive.Close()
+
+			Expect(ctfArchive.AddComponentArchiveWithName("a", newTestComponentArchive("example.com/a", "0.0.0"), ctf.ArchiveFormatFilesystem)).To(Succeed())
+			Expect(ctfArchive.AddComponentArchiveWithName("a", newTestComponentArchive("example.com/a", "0.0.1"), ctf.ArchiveFormatTar)).To(Succeed())
+			Expect(vfs.FileExists(fs, "/ctf/a")).To(BeTrue())
+
+			var versions []string
+			Expect(ctfArchive.Walk(func(ca *ctf.ComponentArchive) error {
+				versions = append(versions, ca.ComponentDescriptor.GetVersion())
+				return nil
+			})).To(Succeed())
+			Expect(versions).To(ConsistOf("0.0.1"))
+		})
+
+		It("should pack and unpack filesystem archives of a ctf", func() {
+			fs := memoryfs.New()
+			ctfArchive := newTestCTF(fs, "/ctf.tar")
+			a := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a, "res", []byte("blob a"))
+			Expect(ctfArchive.AddComponentArchiveWithName("a", a, ctf.ArchiveFormatFilesystem)).To(Succeed())
+			Expect(ctfArchive.AddComponentArchiveWithName("b.tar", newTestComponentArchive("example.com/b", "0.0.0"), ctf.ArchiveFormatTar)).To(Succeed())
+			Expect(ctfArchive.Write()).To(Succeed())
+			Expect(ctfArchive.WriteToFilesystem(fs, "/unpacked")).To(Succeed())
+			Expect(ctfArchive.Close()).To(Succeed())
+
+			packed, err := ctf.NewCTF(fs, "/ctf.tar")
+			Expect(err).ToNot(HaveOccurred())
+			defer packed.Close()
+			expectComponents(packed, "example.com/a", "example.com/b")
+
+			unpacked, err := ctf.NewCTF(fs, "/unpacked")
+			Expect(err).ToNot(HaveOccurred())
+			defer unpacked.Close()
+			expectComponents(unpacked, "example.com/a", "example.com/b")
+
+			indexed, err := ctf.NewIndexedCTF(fs, "/ctf.tar")
+			Expect(err).ToNot(HaveOccurred())
+			defer indexed.Close()
+			cd, blobResolver, err := indexed.ResolveWithBlobResolver(context.Background(), nil, "example.com/a", "0.0.0")
+			Expect(err).ToNot(HaveOccurred())
+			var blob bytes.Buffer
+			_, err = blobResolver.Resolve(context.Background(), cd.Resources[0], &blob)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(blob.String()).To(Equal("blob a"))
+		})
+
+	})
+
+	Context("Modification", func() {
+
+		var (
+			fs         vfs.FileSystem
+			ctfArchive *ctf.CTF
+		)
+
+		BeforeEach(func() {
+			fs = memoryfs.New()
+			ctfArchive = newTestCTF(fs, "/ctf.tar")
+			Expect(ctfArchive.AddComponentArchive(newTestComponentArchive("example.com/a", "0.0.0"), ctf.ArchiveFormatTar)).To(Succeed())
+			Expect(ctfArchive.AddComponentArchive(newTestComponentArchive("example.com/b", "0.0.0"), ctf.ArchiveFormatTar)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(ctfArchive.Close()).To(Succeed())
+		})
+
+		It("should list all component archives", func() {
+			a := newTestComponentArchive("example.com/a", "0.0.0")
+			dig, err := a.Digest()
+			Expect(err).ToNot(HaveOccurred())
+
+			list, err := ctfArchive.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(list).To(HaveLen(2))
+			Expect(list).To(ContainElement(ctf.ComponentArchiveInfo{
+				Name:    "example.com/a",
+				Version: "0.0.0",
+				Digest:  dig,
+				Path:    dig,
+			}))
+		})
+
+		It("should only read the component descriptors to list component archives", func() {
+			c := newTestComponentArchive("example.com/c", "0.0.0")
+			addTestBlob(c, "res", bytes.Repeat([]byte("blob c"), 4096))
+			var data bytes.Buffer
+			Expect(c.WriteTar(&data)).To(Succeed())
+			// the truncated archive still contains the complete component descriptor but only a part of the blob.
+			Expect(fs.MkdirAll("/ctf", os.ModePerm)).To(Succeed())
+			Expect(vfs.WriteFile(fs, "/ctf/c.tar", data.Bytes()[:data.Len()/2], os.ModePerm)).To(Succeed())
+			dirArchive, err := ctf.NewCTF(fs, "/ctf")
+			Expect(err).ToNot(HaveOccurred())
+
+			list, err := dirArchive.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(list).To(HaveLen(1))
+			Expect(list[0].Name).To(Equal("example.com/c"))
+			Expect(dirArchive.Walk(func(ca *ctf.ComponentArchive) error { return nil })).ToNot(Succeed())
+		})
+
+		It("should remove a component archive", func() {
+			Expect(ctfArchive.Remove("example.com/a", "0.0.0")).To(Succeed())
+			expectComponents(ctfArchive, "example.com/b")
+			Expect(ctfArchive.Remove("example.com/a", "0.0.0")).To(MatchError(ctf.NotFoundError))
+		})
+
+		It("should replace a changed component archive", func() {
+			a := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a, "res", []byte("blob a"))
+			Expect(ctfArchive.Replace(a, ctf.ArchiveFormatTarGzip)).To(Succeed())
+
+			list, err := ctfArchive.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(list).To(HaveLen(2))
+			Expect(ctfArchive.Walk(func(ca *ctf.ComponentArchive) error {
+				if ca.ComponentDescriptor.GetName() == "example.com/a" {
+					Expect(ca.ComponentDescriptor.Resources).To(HaveLen(1))
+				}
+				return nil
+			})).To(Succeed())
+			Expect(ctfArchive.Write()).To(Succeed())
+		})
+
+		It("should not write a ctf with duplicate components", func() {
+			a := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a, "res", []byte("blob a"))
+			Expect(ctfArchive.AddComponentArchive(a, ctf.ArchiveFormatTar)).To(Succeed())
+
+			err := ctfArchive.Write()
+			Expect(errors.Is(err, ctf.DuplicateComponentError)).To(BeTrue())
+		})
+
+	})
+
+	Context("Compression", func() {
+
+		It("should detect the compression of component archives", func() {
+			dir, err := os.MkdirTemp("", "ctf-test-")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			ca := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(ca, "res", []byte("blob a"))
+			writers := map[string]func(io.Writer, ...ctf.WriteOption) error{
+				"ca.tar":  ca.WriteTar,
+				"ca.tgz":  ca.WriteTarGzip,
+				"ca.tzst": ca.WriteTarZstd,
+			}
+			for name, write := range writers {
+				var buf bytes.Buffer
+				Expect(write(&buf)).To(Succeed())
+				path := filepath.Join(dir, name)
+				Expect(os.WriteFile(path, buf.Bytes(), os.ModePerm)).To(Succeed())
+
+				read, err := ctf.ComponentArchiveFromCTF(path)
+				Expect(err).ToNot(HaveOccurred(), name)
+				Expect(read.ComponentDescriptor.Resources).To(HaveLen(1))
+				read, err = ctf.ComponentArchiveFromCompressedCTF(path)
+				Expect(err).ToNot(HaveOccurred(), name)
+				Expect(read.ComponentDescriptor.GetName()).To(Equal("example.com/a"))
+			}
+		})
+
+		It("should read zstd compressed component archives of a ctf", func() {
+			fs := memoryfs.New()
+			ctfArchive := newTestCTF(fs, "/ctf.tar")
+			a := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a, "res", []byte("blob a"))
+			Expect(ctfArchive.AddComponentArchive(a, ctf.ArchiveFormatTarZstd)).To(Succeed())
+			Expect(ctfArchive.Write()).To(Succeed())
+			expectComponents(ctfArchive, "example.com/a")
+			Expect(ctfArchive.Close()).To(Succeed())
+
+			indexed, err := ctf.NewIndexedCTF(fs, "/ctf.tar")
+			Expect(err).ToNot(HaveOccurred())
+			defer indexed.Close()
+			cd, blobResolver, err := indexed.ResolveWithBlobResolver(context.Background(), nil, "example.com/a", "0.0.0")
+			Expect(err).ToNot(HaveOccurred())
+			var blob bytes.Buffer
+			_, err = blobResolver.Resolve(context.Background(), cd.Resources[0], &blob)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(blob.String()).To(Equal("blob a"))
+		})
+
+	})
+
+	Context("Reproducible", func() {
+
+		It("should write identical component archives independent of the order of blobs and the time", func() {
+			a1 := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a1, "res1", []byte("blob 1"))
+			addTestBlob(a1, "res2", []byte("blob 2"))
+			a2 := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a2, "res2", []byte("blob 2"))
+			addTestBlob(a2, "res1", []byte("blob 1"))
+			a2.ComponentDescriptor.Resources = a1.ComponentDescriptor.Resources
+
+			var out1, out2 bytes.Buffer
+			Expect(a1.WriteTarGzip(&out1, ctf.Reproducible(true))).To(Succeed())
+			time.Sleep(1100 * time.Millisecond)
+			Expect(a2.WriteTarGzip(&out2, ctf.Reproducible(true))).To(Succeed())
+			Expect(out1.Bytes()).To(Equal(out2.Bytes()))
+
+			gr, err := gzip.NewReader(&out1)
+			Expect(err).ToNot(HaveOccurred())
+			tr := tar.NewReader(gr)
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).ToNot(HaveOccurred())
+				Expect(header.ModTime.Equal(ctf.ReproducibleModTime)).To(BeTrue())
+				Expect(header.Uid).To(Equal(0))
+				Expect(header.Uname).To(BeEmpty())
+			}
+		})
+
+		It("should write identical ctfs independent of the order of added archives", func() {
+			fs := memoryfs.New()
+			write := func(path string, names ...string) []byte {
+				ctfArchive := newTestCTF(fs, path)
+				defer ctfArchive.Close()
+				for _, name := range names {
+					Expect(ctfArchive.AddComponentArchive(newTestComponentArchive(name, "0.0.0"), ctf.ArchiveFormatTarGzip, ctf.Reproducible(true))).To(Succeed())
+				}
+				Expect(ctfArchive.Write(ctf.Reproducible(true))).To(Succeed())
+				data, err := vfs.ReadFile(fs, path)
+				Expect(err).ToNot(HaveOccurred())
+				return data
+			}
+			Expect(write("/ctf1.tar", "example.com/a", "example.com/b")).To(Equal(write("/ctf2.tar", "example.com/b", "example.com/a")))
+		})
+
+	})
+
+	Context("Shared blobs", func() {
+
+		It("should store blobs that are used by multiple component archives only once", func() {
+			fs := memoryfs.New()
+			ctfArchive := newTestCTF(fs, "/ctf.tar")
+			a := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a, "res", []byte("shared blob"))
+			b := newTestComponentArchive("example.com/b", "0.0.0")
+			addTestBlob(b, "res", []byte("shared blob"))
+			Expect(ctfArchive.AddComponentArchiveWithName("a.tar", a, ctf.ArchiveFormatTar)).To(Succeed())
+			Expect(ctfArchive.AddComponentArchiveWithName("b.tgz", b, ctf.ArchiveFormatTarGzip)).To(Succeed())
+			Expect(ctfArchive.ConvertBlobLayout(ctf.BlobLayoutShared)).To(Succeed())
+			Expect(ctfArchive.Write()).To(Succeed())
+			Expect(ctfArchive.Close()).To(Succeed())
+
+			blobName := "blobs/" + digest.FromString("shared blob").String()
+			Expect(tarEntries(fs, "/ctf.tar")).To(ContainElement(blobName))
+
+			ctfArchive, err := ctf.NewCTF(fs, "/ctf.tar")
+			Expect(err).ToNot(HaveOccurred())
+			defer ctfArchive.Close()
+			Expect(ctfArchive.BlobLayout()).To(Equal(ctf.BlobLayoutShared))
+			expectComponents(ctfArchive, "example.com/a", "example.com/b")
+			Expect(ctfArchive.Walk(func(ca *ctf.ComponentArchive) error {
+				var blob bytes.Buffer
+				_, err := ca.Resolve(context.Background(), ca.ComponentDescriptor.Resources[0], &blob)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(blob.String()).To(Equal("shared blob"))
+				return nil
+			})).To(Succeed())
+
+			indexed, err := ctf.NewIndexedCTF(fs, "/ctf.tar")
+			Expect(err).ToNot(HaveOccurred())
+			defer indexed.Close()
+			cd, blobResolver, err := indexed.ResolveWithBlobResolver(context.Background(), nil, "example.com/a", "0.0.0")
+			Expect(err).ToNot(HaveOccurred())
+			var blob bytes.Buffer
+			_, err = blobResolver.Resolve(context.Background(), cd.Resources[0], &blob)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(blob.String()).To(Equal("shared blob"))
+		})
+
+		It("should convert a ctf back to self-contained component archives", func() {
+			fs := memoryfs.New()
+			ctfArchive := newTestCTF(fs, "/ctf.tar")
+			Expect(ctfArchive.ConvertBlobLayout(ctf.BlobLayoutShared)).To(Succeed())
+			a := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a, "res", []byte("blob a"))
+			Expect(ctfArchive.AddComponentArchiveWithName("a.tar", a, ctf.ArchiveFormatTar)).To(Succeed())
+			Expect(ctfArchive.Write()).To(Succeed())
+			Expect(tarEntries(fs, "/ctf.tar")).To(ContainElement("blobs/" + digest.FromString("blob a").String()))
+
+			Expect(ctfArchive.ConvertBlobLayout(ctf.BlobLayoutArchive)).To(Succeed())
+			Expect(ctfArchive.Write()).To(Succeed())
+			Expect(ctfArchive.Close()).To(Succeed())
+			Expect(tarEntries(fs, "/ctf.tar")).To(ConsistOf("a.tar"))
+
+			indexed, err := ctf.NewIndexedCTF(fs, "/ctf.tar")
+			Expect(err).ToNot(HaveOccurred())
+			defer indexed.Close()
+			ca, err := indexed.ComponentArchive("example.com/a", "0.0.0")
+			Expect(err).ToNot(HaveOccurred())
+			var blob bytes.Buffer
+			_, err = ca.Resolve(context.Background(), ca.ComponentDescriptor.Resources[0], &blob)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(blob.String()).To(Equal("blob a"))
+		})
+
+		It("should not modify filesystem archives of a ctf directory when shared blobs are read", func() {
+			fs := memoryfs.New()
+			Expect(fs.MkdirAll("/ctf", os.ModePerm)).To(Succeed())
+			ctfArchive, err := ctf.NewCTF(fs, "/ctf")
+			Expect(err).ToNot(HaveOccurred())
+			defer ctfArchive.Close()
+			a := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a, "res", []byte("blob a"))
+			Expect(ctfArchive.AddComponentArchiveWithName("a", a, ctf.ArchiveFormatFilesystem)).To(Succeed())
+			Expect(ctfArchive.ConvertBlobLayout(ctf.BlobLayoutShared)).To(Succeed())
+
+			blobName := digest.FromString("blob a").String()
+			Expect(vfs.FileExists(fs, "/ctf/blobs/"+blobName)).To(BeTrue())
+			Expect(vfs.FileExists(fs, "/ctf/a/blobs/"+blobName)).To(BeFalse())
+			Expect(ctfArchive.Walk(func(ca *ctf.ComponentArchive) error {
+				var blob bytes.Buffer
+				_, err := ca.Resolve(context.Background(), ca.ComponentDescriptor.Resources[0], &blob)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(blob.String()).To(Equal("blob a"))
+				return nil
+			})).To(Succeed())
+			Expect(vfs.FileExists(fs, "/ctf/a/blobs/"+blobName)).To(BeFalse())
+		})
+
+		It("should read shared blobs only when they are resolved or written", func() {
+			fs := memoryfs.New()
+			Expect(fs.MkdirAll("/ctf", os.ModePerm)).To(Succeed())
+			ctfArchive, err := ctf.NewCTF(fs, "/ctf")
+			Expect(err).ToNot(HaveOccurred())
+			defer ctfArchive.Close()
+			Expect(ctfArchive.ConvertBlobLayout(ctf.BlobLayoutShared)).To(Succeed())
+			a := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a, "res", []byte("blob a"))
+			Expect(ctfArchive.AddComponentArchiveWithName("a.tar", a, ctf.ArchiveFormatTar)).To(Succeed())
+
+			var ca *ctf.ComponentArchive
+			Expect(ctfArchive.Walk(func(walked *ctf.ComponentArchive) error {
+				ca = walked
+				return nil
+			})).To(Succeed())
+			report, err := ca.Check()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.IsConsistent()).To(BeTrue())
+
+			// the written component archive is self-contained.
+			var data bytes.Buffer
+			Expect(ca.WriteTar(&data)).To(Succeed())
+			written, err := ctf.NewComponentArchiveFromTarReader(&data)
+			Expect(err).ToNot(HaveOccurred())
+			var blob bytes.Buffer
+			_, err = written.Resolve(context.Background(), written.ComponentDescriptor.Resources[0], &blob)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(blob.String()).To(Equal("blob a"))
+
+			// the shared blob has not been copied into the component archive.
+			Expect(fs.Remove("/ctf/blobs/" + digest.FromString("blob a").String())).To(Succeed())
+			_, err = ca.Resolve(context.Background(), ca.ComponentDescriptor.Resources[0], &blob)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should prune unreferenced shared blobs on remove, replace and write", func() {
+			fs := memoryfs.New()
+			Expect(fs.MkdirAll("/ctf", os.ModePerm)).To(Succeed())
+			ctfArchive, err := ctf.NewCTF(fs, "/ctf")
+			Expect(err).ToNot(HaveOccurred())
+			defer ctfArchive.Close()
+			Expect(ctfArchive.ConvertBlobLayout(ctf.BlobLayoutShared)).To(Succeed())
+			a := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a, "shared", []byte("shared blob"))
+			addTestBlob(a, "res", []byte("blob a"))
+			b := newTestComponentArchive("example.com/b", "0.0.0")
+			addTestBlob(b, "shared", []byte("shared blob"))
+			Expect(ctfArchive.AddComponentArchiveWithName("a.tar", a, ctf.ArchiveFormatTar)).To(Succeed())
+			Expect(ctfArchive.AddComponentArchiveWithName("b", b, ctf.ArchiveFormatFilesystem)).To(Succeed())
+
+			sharedBlob := "/ctf/blobs/" + digest.FromString("shared blob").String()
+			blobA := "/ctf/blobs/" + digest.FromString("blob a").String()
+			Expect(vfs.FileExists(fs, sharedBlob)).To(BeTrue())
+			Expect(vfs.FileExists(fs, blobA)).To(BeTrue())
+
+			Expect(ctfArchive.Remove("example.com/a", "0.0.0")).To(Succeed())
+			Expect(vfs.FileExists(fs, blobA)).To(BeFalse())
+			Expect(vfs.FileExists(fs, sharedBlob)).To(BeTrue())
+
+			Expect(ctfArchive.ReplaceWithName("b2.tar", newTestComponentArchive("example.com/b", "0.0.0"), ctf.ArchiveFormatTar)).To(Succeed())
+			Expect(vfs.FileExists(fs, sharedBlob)).To(BeFalse())
+
+			Expect(vfs.WriteFile(fs, blobA, []byte("blob a"), os.ModePerm)).To(Succeed())
+			Expect(ctfArchive.Write()).To(Succeed())
+			Expect(vfs.FileExists(fs, blobA)).To(BeFalse())
+			expectComponents(ctfArchive, "example.com/b")
+		})
+
+		It("should drop unreferenced shared blobs when an indexed ctf is rewritten", func() {
+			fs := memoryfs.New()
+			ctfArchive := newTestCTF(fs, "/ctf.tar")
+			Expect(ctfArchive.ConvertBlobLayout(ctf.BlobLayoutShared)).To(Succeed())
+			a := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(a, "res", []byte("blob a"))
+			b := newTestComponentArchive("example.com/b", "0.0.0")
+			addTestBlob(b, "res", []byte("blob b"))
+			Expect(ctfArchive.AddComponentArchiveWithName("a.tar", a, ctf.ArchiveFormatTar)).To(Succeed())
+			Expect(ctfArchive.AddComponentArchiveWithName("b.tar", b, ctf.ArchiveFormatTar)).To(Succeed())
+			Expect(ctfArchive.Write()).To(Succeed())
+			Expect(ctfArchive.Close()).To(Succeed())
+
+			indexed, err := ctf.NewIndexedCTF(fs, "/ctf.tar")
+			Expect(err).ToNot(HaveOccurred())
+			defer indexed.Close()
+			Expect(indexed.AddComponentArchiveWithName("a.tar", newTestComponentArchive("example.com/a", "0.0.0"), ctf.ArchiveFormatTar)).To(Succeed())
+			Expect(indexed.Write()).To(Succeed())
+			Expect(tarEntries(fs, "/ctf.tar")).To(ConsistOf("a.tar", "b.tar", "blobs/"+digest.FromString("blob b").String()))
+		})
+
+	})
+
+	Context("Merge", func() {
+
+		var fs vfs.FileSystem
+
+		BeforeEach(func() {
+			fs = memoryfs.New()
+		})
+
+		newCTF := func(path string, archives map[string]*ctf.ComponentArchive) *ctf.CTF {
+			ctfArchive := newTestCTF(fs, path)
+			for name, ca := range archives {
+				Expect(ctfArchive.AddComponentArchiveWithName(name, ca, ctf.ArchiveFormatTarGzip)).To(Succeed())
+			}
+			return ctfArchive
+		}
+
+		It("should add new and deduplicate identical component archives", func() {
+			target := newCTF("/target.tar", map[string]*ctf.ComponentArchive{
+				"a.tgz": newTestComponentArchive("example.com/a", "0.0.0"),
+			})
+			defer target.Close()
+			source1 := newCTF("/source1.tar", map[string]*ctf.ComponentArchive{
+				"a.tgz": newTestComponentArchive("example.com/a", "0.0.0"),
+				"b.tgz": newTestComponentArchive("example.com/b", "0.0.0"),
+			})
+			defer source1.Close()
+			// the path of the archive is already used by another component.
+			source2 := newCTF("/source2.tar", map[string]*ctf.ComponentArchive{
+				"a.tgz": newTestComponentArchive("example.com/c", "0.0.0"),
+			})
+			defer source2.Close()
+
+			report, err := target.Merge([]*ctf.CTF{source1, source2})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Deduplicated).To(HaveLen(1))
+			Expect(report.Deduplicated[0].Name).To(Equal("example.com/a"))
+			Expect(report.Replaced).To(BeEmpty())
+			Expect(report.Added).To(HaveLen(2))
+			Expect(report.Added[0].Path).To(Equal("b.tgz"))
+			Expect(report.Added[1].Path).To(Equal(report.Added[1].Digest))
+			expectComponents(target, "example.com/a", "example.com/b", "example.com/c")
+			Expect(target.Write()).To(Succeed())
+		})
+
+		It("should not modify the ctf if a component conflicts", func() {
+			target := newCTF("/target.tar", map[string]*ctf.ComponentArchive{
+				"a.tgz": newTestComponentArchive("example.com/a", "0.0.0"),
+			})
+			defer target.Close()
+			changed := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(changed, "res", []byte("changed"))
+			source := newCTF("/source.tar", map[string]*ctf.ComponentArchive{
+				"b.tgz": newTestComponentArchive("example.com/b", "0.0.0"),
+				"c.tgz": changed,
+			})
+			defer source.Close()
+
+			_, err := target.Merge([]*ctf.CTF{source})
+			Expect(errors.Is(err, ctf.MergeConflictError)).To(BeTrue())
+			expectComponents(target, "example.com/a")
+		})
+
+		It("should replace conflicting component archives with the overwrite policy", func() {
+			target := newCTF("/target.tar", map[string]*ctf.ComponentArchive{
+				"a.tgz": newTestComponentArchive("example.com/a", "0.0.0"),
+			})
+			defer target.Close()
+			changed := newTestComponentArchive("example.com/a", "0.0.0")
+			addTestBlob(changed, "res", []byte("changed"))
+			source := newCTF("/source.tar", map[string]*ctf.ComponentArchive{
+				"other.tgz": changed,
+			})
+			defer source.Close()
+
+			report, err := target.Merge([]*ctf.CTF{source}, ctf.MergePolicyOverwrite)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Replaced).To(HaveLen(1))
+			list, err := target.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(list).To(HaveLen(1))
+			Expect(list[0].Path).To(Equal("other.tgz"))
+			Expect(list[0].Digest).To(Equal(report.Replaced[0].Digest))
+		})
+
+		It("should report the path within the merged ctf for deduplicated component archives", func() {
+			target := newCTF("/target.tar", map[string]*ctf.ComponentArchive{
+				"x.tgz": newTestComponentArchive("example.com/c", "0.0.0"),
+			})
+			defer target.Close()
+			// the archive is renamed by its digest as the path is already used.
+			source1 := newCTF("/source1.tar", map[string]*ctf.ComponentArchive{
+				"x.tgz": newTestComponentArchive("example.com/d", "0.0.0"),
+			})
+			defer source1.Close()
+			source2 := newCTF("/source2.tar", map[string]*ctf.ComponentArchive{
+				"y.tgz": newTestComponentArchive("example.com/d", "0.0.0"),
+			})
+			defer source2.Close()
+
+			report, err := target.Merge([]*ctf.CTF{source1, source2})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Added).To(HaveLen(1))
+			Expect(report.Added[0].Path).To(Equal(report.Added[0].Digest))
+			Expect(report.Deduplicated).To(Equal(report.Added))
+			list, err := target.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(list).To(ContainElement(report.Deduplicated[0]))
+		})
+
+	})
+
+})
+
+// tarEntries returns the names of all regular files of the tar at the given path.
+func tarEntries(fs vfs.FileSystem, path string) []string {
+	file, err := fs.Open(path)
+	Expect(err).ToNot(HaveOccurred())
+	defer file.Close()
+	var names []string
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		Expect(err).ToNot(HaveOccurred())
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, header.Name)
+		}
+	}
+}
+
+// expectComponents expects that the ctf contains exactly the given components.
+func expectComponents(ctfArchive *ctf.CTF, names ...string) {
+	var found []string
+	Expect(ctfArchive.Walk(func(ca *ctf.ComponentArchive) error {
+		found = append(found, ca.ComponentDescriptor.GetName())
+		return nil
+	})).To(Succeed())
+	Expect(found).To(ConsistOf(names))
+}
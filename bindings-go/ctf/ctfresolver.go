@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf
+
+import (
+	"context"
+	"fmt"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+)
+
+// componentKey identifies a component archive by its component name and version.
+type componentKey struct {
+	Name    string
+	Version string
+}
+
+// CTFResolver describes a ComponentResolver that resolves component descriptors
+// from the component archives of a CTF.
+// The CTF itself is the repository, so the repository context of a request is ignored.
+type CTFResolver struct {
+	ctf   *CTF
+	index map[componentKey]string
+}
+
+// NewCTFResolver creates a new resolver for the given ctf.
+// All component archives of the ctf are indexed by their name and version,
+// so the ctf must not be modified while the resolver is used.
+func NewCTFResolver(ctf *CTF) (*CTFResolver, error) {
+	r := &CTFResolver{
+		ctf:   ctf,
+		index: map[componentKey]string{},
+	}
+	list, err := ctf.List()
+	if err != nil {
+		return nil, fmt.Errorf("unable to index ctf: %w", err)
+	}
+	for _, info := range list {
+		key := componentKey{
+			Name:    info.Name,
+			Version: info.Version,
+		}
+		if existing, ok := r.index[key]; ok {
+			return nil, fmt.Errorf("unable to index ctf: %w: component %q in version %q is contained in %q and %q", DuplicateComponentError, key.Name, key.Version, existing, info.Path)
+		}
+		r.index[key] = info.Path
+	}
+	return r, nil
+}
+
+var _ ComponentResolver = &CTFResolver{}
+
+// Resolve resolves a component descriptor.
+// Only the component descriptor of the component archive is read.
+func (r *CTFResolver) Resolve(_ context.Context, _ cdv2.Repository, name, version string) (*cdv2.ComponentDescriptor, error) {
+	path, err := r.path(name, version)
+	if err != nil {
+		return nil, err
+	}
+	return r.ctf.readComponentDescriptor(path)
+}
+
+// ResolveWithBlobResolver resolves a component descriptor and returns the blob resolver of its component archive.
+func (r *CTFResolver) ResolveWithBlobResolver(_ context.Context, _ cdv2.Repository, name, version string) (*cdv2.ComponentDescriptor, BlobResolver, error) {
+	path, err := r.path(name, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := r.ctf.readComponentArchive(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca.ComponentDescriptor, ca.BlobResolver, nil
+}
+
+// path returns the path of the component archive of the given component within the ctf.
+func (r *CTFResolver) path(name, version string) (string, error) {
+	path, ok := r.index[componentKey{Name: name, Version: version}]
+	if !ok {
+		return "", NotFoundError
+	}
+	return "/" + path, nil
+}
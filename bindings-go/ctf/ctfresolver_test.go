@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+
+	"github.com/mandelsoft/vfs/pkg/memoryfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+	"github.com/gardener/component-spec/bindings-go/ctf/ctfutils"
+)
+
+var _ = Describe("CTFResolver", func() {
+
+	It("should resolve a component descriptor and its blobs from a ctf", func() {
+		ctx := context.Background()
+		fs := memoryfs.New()
+		ctfArchive := newTestCTF(fs, "/ctf.tar")
+		defer ctfArchive.Close()
+
+		ca := newTestComponentArchive("example.com/a", "0.0.0")
+		data := []byte("blob")
+		res := cdv2.Resource{
+			IdentityObjectMeta: cdv2.IdentityObjectMeta{
+				Name:    "res",
+				Version: "0.0.0",
+				Type:    "blob",
+			},
+			Relation: cdv2.LocalRelation,
+		}
+		Expect(ca.AddResource(&res, ctf.BlobInfo{
+			MediaType: "txt",
+			Digest:    digest.FromBytes(data).String(),
+			Size:      int64(len(data)),
+		}, bytes.NewBuffer(data))).To(Succeed())
+		Expect(ctfArchive.AddComponentArchive(ca, ctf.ArchiveFormatTar)).To(Succeed())
+
+		resolver, err := ctf.NewCTFResolver(ctfArchive)
+		Expect(err).ToNot(HaveOccurred())
+		cd, blobResolver, err := resolver.ResolveWithBlobResolver(ctx, nil, "example.com/a", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cd.Name).To(Equal("example.com/a"))
+		Expect(blobResolver).To(BeAssignableToTypeOf(&ctf.ComponentArchiveBlobResolver{}))
+
+		var blob bytes.Buffer
+		_, err = blobResolver.Resolve(ctx, cd.Resources[0], &blob)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blob.Bytes()).To(Equal(data))
+
+		_, err = resolver.Resolve(ctx, nil, "example.com/a", "0.0.1")
+		Expect(err).To(Equal(ctf.NotFoundError))
+	})
+
+	It("should only read the component descriptor to resolve a component", func() {
+		ctx := context.Background()
+		fs := memoryfs.New()
+		Expect(fs.MkdirAll("/ctf", os.ModePerm)).To(Succeed())
+		ctfArchive, err := ctf.NewCTF(fs, "/ctf")
+		Expect(err).ToNot(HaveOccurred())
+		a := newTestComponentArchive("example.com/a", "0.0.0")
+		addTestBlob(a, "res", bytes.Repeat([]byte("a"), 4096))
+		Expect(ctfArchive.AddComponentArchive(a, ctf.ArchiveFormatTar)).To(Succeed())
+		Expect(ctfArchive.Close()).To(Succeed())
+
+		// the blob exceeds the maximal file size, so that it cannot be extracted.
+		ctfArchive, err = ctf.NewCTF(fs, "/ctf", ctf.MaxFileSize(1024))
+		Expect(err).ToNot(HaveOccurred())
+		defer ctfArchive.Close()
+		resolver, err := ctf.NewCTFResolver(ctfArchive)
+		Expect(err).ToNot(HaveOccurred())
+
+		cd, err := resolver.Resolve(ctx, nil, "example.com/a", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cd.Name).To(Equal("example.com/a"))
+		Expect(cd.Resources).To(HaveLen(1))
+
+		_, _, err = resolver.ResolveWithBlobResolver(ctx, nil, "example.com/a", "0.0.0")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should recursively resolve all components of a ctf", func() {
+		ctx := context.Background()
+		fs := memoryfs.New()
+		ctfArchive := newTestCTF(fs, "/ctf.tar")
+		defer ctfArchive.Close()
+
+		a := newTestComponentArchive("example.com/a", "0.0.0")
+		a.ComponentDescriptor.ComponentReferences = []cdv2.ComponentReference{
+			{Name: "comp-b", ComponentName: "example.com/b", Version: "0.0.0"},
+		}
+		Expect(ctfArchive.AddComponentArchive(a, ctf.ArchiveFormatTar)).To(Succeed())
+		Expect(ctfArchive.AddComponentArchive(newTestComponentArchive("example.com/b", "0.0.0"), ctf.ArchiveFormatTar)).To(Succeed())
+
+		resolver, err := ctf.NewCTFResolver(ctfArchive)
+		Expect(err).ToNot(HaveOccurred())
+		repoCtx := cdv2.NewOCIRegistryRepository("example.com", "")
+		list, err := ctfutils.ResolveList(ctx, resolver, repoCtx, "example.com/a", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(list.Components).To(HaveLen(2))
+	})
+
+})
+
+// newTestCTF creates a new empty ctf in the given filesystem.
+func newTestCTF(fs vfs.FileSystem, path string) *ctf.CTF {
+	file, err := fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(tar.NewWriter(file).Close()).To(Succeed())
+	Expect(file.Close()).To(Succeed())
+	ctfArchive, err := ctf.NewCTF(fs, path)
+	Expect(err).ToNot(HaveOccurred())
+	return ctfArchive
+}
+
+// newTestComponentArchive creates a new component archive with an in-memory filesystem.
+func newTestComponentArchive(name, version string) *ctf.ComponentArchive {
+	cd := &cdv2.ComponentDescriptor{}
+	cd.Name = name
+	cd.Version = version
+	cd.Provider = "internal"
+	Expect(cdv2.DefaultComponent(cd)).To(Succeed())
+	return ctf.NewComponentArchive(cd, memoryfs.New())
+}
@@ -6,77 +6,317 @@ package ctfutils
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
 	"github.com/gardener/component-spec/bindings-go/ctf"
 )
 
+// RepositoryContextLabel is the name of the label of a component reference
+// that defines the repository context of the referenced component.
+// The value of the label is a typed repository context, e.g. an oci registry repository.
+const RepositoryContextLabel = "cloud.gardener.cnudie/repositoryContext"
+
+// ComponentKey identifies a component by its name and version.
+type ComponentKey struct {
+	Name    string
+	Version string
+}
+
+func (k ComponentKey) String() string {
+	return fmt.Sprintf("%s:%s", k.Name, k.Version)
+}
+
+// CycleError is returned if a component transitively references itself.
+type CycleError struct {
+	// Path is the reference path from the root component to the component that closes the cycle.
+	// The last component is also contained earlier in the path.
+	Path []ComponentKey
+}
+
+var _ error = &CycleError{}
+
+func (e *CycleError) Error() string {
+	elems := make([]string, len(e.Path))
+	for i, key := range e.Path {
+		elems[i] = key.String()
+	}
+	return fmt.Sprintf("cyclic component reference: %s", strings.Join(elems, " -> "))
+}
+
+// ResolveOptions defines the options for the recursive resolution of components.
+type ResolveOptions struct {
+	// MaxDepth is the maximal depth of resolved references.
+	// The root component has the depth 0, its direct references the depth 1.
+	// References deeper than the max depth are not resolved.
+	// A max depth of 0 resolves all references.
+	MaxDepth int
+	// Concurrency is the number of components that are resolved in parallel.
+	// Components are resolved sequentially if the concurrency is less than 2.
+	Concurrency int
+}
+
+// ApplyOptions applies the given list options on these options,
+// and then returns itself (for convenient chaining).
+func (o *ResolveOptions) ApplyOptions(opts []ResolveOption) *ResolveOptions {
+	for _, opt := range opts {
+		if opt != nil {
+			opt.ApplyResolveOption(o)
+		}
+	}
+	return o
+}
+
+// ResolveOption is the interface to specify different resolve options.
+type ResolveOption interface {
+	ApplyResolveOption(options *ResolveOptions)
+}
+
+// MaxDepth limits the depth of resolved references.
+type MaxDepth int
+
+// ApplyResolveOption applies the configured max depth.
+func (d MaxDepth) ApplyResolveOption(options *ResolveOptions) {
+	options.MaxDepth = int(d)
+}
+
+// Concurrency configures the number of components that are resolved in parallel.
+type Concurrency int
+
+// ApplyResolveOption applies the configured concurrency.
+func (c Concurrency) ApplyResolveOption(options *ResolveOptions) {
+	options.Concurrency = int(c)
+}
+
 // ResolveList resolves all component descriptors of a given root component descriptor.
+// The list contains every component once in the order of ResolveRecursive.
 func ResolveList(ctx context.Context,
 	resolver ctf.ComponentResolver,
 	repoCtx cdv2.Repository,
 	name,
-	version string) (*cdv2.ComponentDescriptorList, error) {
+	version string,
+	opts ...ResolveOption) (*cdv2.ComponentDescriptorList, error) {
 
 	list := &cdv2.ComponentDescriptorList{}
 	err := ResolveRecursive(ctx, resolver, repoCtx, name, version, func(cd *cdv2.ComponentDescriptor) (stop bool, err error) {
-		if _, err := list.GetComponent(cd.Name, cd.Version); err != nil {
-			list.Components = append(list.Components, *cd)
-		}
+		list.Components = append(list.Components, *cd)
 		return false, nil
-	})
+	}, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return list, nil
 }
 
+// ReferenceRepositoryContext returns the repository context that is used to resolve a reference of a component.
+// The repository context is taken from
+// - the RepositoryContextLabel of the reference
+// - the effective repository context of the referencing component
+// - the given root repository context
+// in that order.
+func ReferenceRepositoryContext(root cdv2.Repository, cd *cdv2.ComponentDescriptor, ref cdv2.ComponentReference) (cdv2.Repository, error) {
+	if data, ok := ref.Labels.Get(RepositoryContextLabel); ok {
+		repoCtx := &cdv2.UnstructuredTypedObject{}
+		if err := json.Unmarshal(data, repoCtx); err != nil {
+			return nil, fmt.Errorf("invalid repository context label of reference %q: %w", ref.GetName(), err)
+		}
+		return repoCtx, nil
+	}
+	if repoCtx := cd.GetEffectiveRepositoryContext(); repoCtx != nil {
+		return repoCtx, nil
+	}
+	return root, nil
+}
+
 // ResolvedCallbackFunc describes a function that is called when a component descriptor is resolved.
 // The function can optionally return an bool which when set to true stops the resolve of further component descriptors
 type ResolvedCallbackFunc func(descriptor *cdv2.ComponentDescriptor) (stop bool, err error)
 
+// errStopResolve is used internally to stop the resolve if a callback requests it.
+var errStopResolve = errors.New("stop resolve")
+
 // ResolveRecursive recursively resolves all component descriptors dependencies.
-// Everytime a new component descriptor is resolved the given callback function is called.
+// Every component is resolved exactly once, even if it is referenced multiple times.
+// The given callback function is called for the root component and then for all direct references of a component
+// in the order of the references, before the references of these components are resolved.
+// A CycleError is returned if a component transitively references itself.
+// The references are resolved in the repository context returned by ReferenceRepositoryContext,
+// so that components can reference components of other repositories.
+// If a concurrency is configured, the references of resolved components are prefetched by a pool of workers
+// while the callback is still called sequentially in the same order as without concurrency.
+// The workers are stopped when the function returns or the context is canceled.
 // The resolve of further components can be stopped when
 // - the callback returns true for the stop parameter
 // - the callback returns an error
 // - all components are successfully resolved.
-func ResolveRecursive(ctx context.Context, resolver ctf.ComponentResolver, repoCtx cdv2.Repository, name, version string, cb ResolvedCallbackFunc) error {
-	cd, err := resolver.Resolve(ctx, repoCtx, name, version)
-	if err != nil {
-		return fmt.Errorf("unable to resolve component descriptor for %q %q %q: %w", repoCtx.GetType(), name, version, err)
+func ResolveRecursive(ctx context.Context, resolver ctf.ComponentResolver, repoCtx cdv2.Repository, name, version string, cb ResolvedCallbackFunc, opts ...ResolveOption) error {
+	return resolveRecursive(ctx, resolver, repoCtx, name, version, func(wctx WalkContext) (bool, error) {
+		return cb(wctx.Component)
+	}, opts...)
+}
+
+// resolveRecursive recursively resolves all component descriptors like ResolveRecursive
+// and calls the callback with the context of every resolved component.
+func resolveRecursive(ctx context.Context, resolver ctf.ComponentResolver, repoCtx cdv2.Repository, name, version string, cb func(wctx WalkContext) (bool, error), opts ...ResolveOption) error {
+	options := (&ResolveOptions{}).ApplyOptions(opts)
+	r := &recursiveResolver{
+		resolve: func(ctx context.Context, repoCtx cdv2.Repository, name, version string, _ int) (*cdv2.ComponentDescriptor, error) {
+			return resolver.Resolve(ctx, repoCtx, name, version)
+		},
+		rootRepoCtx: repoCtx,
+		cb:          cb,
+		options:     options,
+		visited:     map[ComponentKey]*visitedComponent{},
 	}
-	stop, err := cb(cd)
-	if err != nil {
-		return fmt.Errorf("error while calling callback for %q %q %q: %w", repoCtx.GetType(), name, version, err)
+	if options.Concurrency > 1 {
+		p := newPrefetcher(ctx, resolver, repoCtx, options)
+		defer p.Close()
+		r.resolve = p.Get
+	}
+	key := ComponentKey{Name: name, Version: version}
+	root, err := r.report(ctx, nil, repoCtx, key, 0)
+	if err == nil {
+		err = r.visitReferences(ctx, []ComponentKey{key}, nil, root, 0)
 	}
-	if stop {
+	if err == errStopResolve {
 		return nil
 	}
-	return resolveRecursive(ctx, resolver, repoCtx, cd, cb)
+	return err
+}
+
+// recursiveResolver holds the state of a recursive resolve.
+type recursiveResolver struct {
+	// resolve resolves a component that is referenced in the given depth.
+	resolve     func(ctx context.Context, repoCtx cdv2.Repository, name, version string, depth int) (*cdv2.ComponentDescriptor, error)
+	rootRepoCtx cdv2.Repository
+	cb          func(wctx WalkContext) (bool, error)
+	options     *ResolveOptions
+	visited     map[ComponentKey]*visitedComponent
+}
+
+// visitedComponent is a component that has already been resolved.
+type visitedComponent struct {
+	cd *cdv2.ComponentDescriptor
+	// depth is the minimal depth in which the component has been visited.
+	depth int
+	// references are the keys of the referenced components once the references have been visited.
+	references []ComponentKey
+}
+
+// visitedReference is a referenced component whose references still have to be visited.
+type visitedReference struct {
+	component *visitedComponent
+	// path contains the keys of all components from the root to the component.
+	path []ComponentKey
+	// refs contains the followed references.
+	refs []cdv2.ComponentReference
 }
 
-func resolveRecursive(ctx context.Context, resolver ctf.ComponentResolver, repoCtx cdv2.Repository, cd *cdv2.ComponentDescriptor, cb ResolvedCallbackFunc) error {
-	components := make([]*cdv2.ComponentDescriptor, 0)
-	for _, ref := range cd.ComponentReferences {
-		cd, err := resolver.Resolve(ctx, repoCtx, ref.ComponentName, ref.Version)
+// report resolves the component if it has not been resolved yet and calls the callback for it.
+// Nil is returned if the references of the component do not have to be visited,
+// as they have already been visited in the same or a lower depth.
+// A component is visited again if it is reached in a lower depth than before,
+// so that the max depth is applied to the shortest path.
+func (r *recursiveResolver) report(ctx context.Context, refs []cdv2.ComponentReference, repoCtx cdv2.Repository, key ComponentKey, depth int) (*visitedComponent, error) {
+	v, ok := r.visited[key]
+	if ok {
+		if r.options.MaxDepth == 0 || v.depth <= depth {
+			return nil, nil
+		}
+	} else {
+		cd, err := r.resolve(ctx, repoCtx, key.Name, key.Version, depth)
 		if err != nil {
-			return fmt.Errorf("unable to resolve component descriptor for %q %q %q: %w", repoCtx.GetType(), ref.ComponentName, ref.Version, err)
+			return nil, fmt.Errorf("unable to resolve component descriptor for %q %q %q: %w", repoCtx.GetType(), key.Name, key.Version, err)
 		}
-		components = append(components, cd)
-		stop, err := cb(cd)
+		v = &visitedComponent{cd: cd}
+		r.visited[key] = v
+		stop, err := r.cb(WalkContext{
+			Component:         cd,
+			RepositoryContext: repoCtx,
+			Path:              refs,
+		})
 		if err != nil {
-			return fmt.Errorf("error while calling callback for %q %q %q: %w", repoCtx.GetType(), ref.ComponentName, ref.Version, err)
+			return nil, fmt.Errorf("error while calling callback for %q %q %q: %w", repoCtx.GetType(), key.Name, key.Version, err)
 		}
 		if stop {
-			return nil
+			return nil, errStopResolve
 		}
 	}
-	for _, ref := range components {
-		if err := resolveRecursive(ctx, resolver, repoCtx, ref, cb); err != nil {
+	v.depth = depth
+	return v, nil
+}
+
+// visitReferences reports all direct references of the component
+// and afterwards visits the references of the referenced components.
+// The path contains the keys of all components from the root to the component,
+// refs contains the followed references.
+func (r *recursiveResolver) visitReferences(ctx context.Context, path []ComponentKey, refs []cdv2.ComponentReference, v *visitedComponent, depth int) error {
+	if r.options.MaxDepth > 0 && depth >= r.options.MaxDepth {
+		return nil
+	}
+	v.references = make([]ComponentKey, 0, len(v.cd.ComponentReferences))
+	children := make([]visitedReference, 0, len(v.cd.ComponentReferences))
+	for _, ref := range v.cd.ComponentReferences {
+		refRepoCtx, err := ReferenceRepositoryContext(r.rootRepoCtx, v.cd, ref)
+		if err != nil {
+			return err
+		}
+		key := ComponentKey{Name: ref.ComponentName, Version: ref.Version}
+		v.references = append(v.references, key)
+		refPath := path[:len(path):len(path)]
+		if cycle := r.findCycle(path, key); cycle != nil {
+			return &CycleError{Path: append(refPath, cycle...)}
+		}
+		followed := append(refs[:len(refs):len(refs)], ref)
+		child, err := r.report(ctx, followed, refRepoCtx, key, depth+1)
+		if err != nil {
+			return err
+		}
+		if child != nil {
+			children = append(children, visitedReference{
+				component: child,
+				path:      append(refPath, key),
+				refs:      followed,
+			})
+		}
+	}
+	for _, child := range children {
+		if err := r.visitReferences(ctx, child.path, child.refs, child.component, depth+1); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// findCycle returns the keys from the given component to the first component of the path
+// that it transitively references with the references that have been visited so far.
+// As the last component of the path references the given component, the keys close a cycle.
+// Nil is returned if the component does not reference any component of the path.
+func (r *recursiveResolver) findCycle(path []ComponentKey, key ComponentKey) []ComponentKey {
+	onPath := make(map[ComponentKey]bool, len(path))
+	for _, k := range path {
+		onPath[k] = true
+	}
+	seen := map[ComponentKey]bool{}
+	var find func(key ComponentKey) []ComponentKey
+	find = func(key ComponentKey) []ComponentKey {
+		if onPath[key] {
+			return []ComponentKey{key}
+		}
+		v, ok := r.visited[key]
+		if !ok || seen[key] {
+			return nil
+		}
+		seen[key] = true
+		for _, ref := range v.references {
+			if cycle := find(ref); cycle != nil {
+				return append([]ComponentKey{key}, cycle...)
+			}
+		}
+		return nil
+	}
+	return find(key)
+}
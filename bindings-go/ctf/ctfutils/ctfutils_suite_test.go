@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctfutils_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+	"github.com/gardener/component-spec/bindings-go/ctf/ctfutils"
+)
+
+func TestConfig(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ctfutils Test Suite")
+}
+
+// testResolver is a component resolver that serves component descriptors from memory
+// and counts how often each component is resolved.
+type testResolver struct {
+	components map[ctfutils.ComponentKey]*cdv2.ComponentDescriptor
+	// hook is optionally called before a component is resolved and can be used to block or inject errors.
+	hook func(ctx context.Context, key ctfutils.ComponentKey) error
+
+	mux      sync.Mutex
+	resolved map[ctfutils.ComponentKey]int
+}
+
+var _ ctf.ComponentResolver = &testResolver{}
+
+// newTestResolver creates a resolver for components that are described by their references,
+// e.g. "a:1" -> ["b:1", "c:1"].
+// The references are named after the referenced component.
+func newTestResolver(graph map[string][]string) *testResolver {
+	r := &testResolver{
+		components: map[ctfutils.ComponentKey]*cdv2.ComponentDescriptor{},
+		resolved:   map[ctfutils.ComponentKey]int{},
+	}
+	for id, refs := range graph {
+		key := parseKey(id)
+		cd := &cdv2.ComponentDescriptor{}
+		cd.Name = key.Name
+		cd.Version = key.Version
+		cd.Provider = "internal"
+		Expect(cdv2.DefaultComponent(cd)).To(Succeed())
+		for _, ref := range refs {
+			refKey := parseKey(ref)
+			cd.ComponentReferences = append(cd.ComponentReferences, cdv2.ComponentReference{
+				Name:          "ref-" + refKey.Name,
+				ComponentName: refKey.Name,
+				Version:       refKey.Version,
+			})
+		}
+		r.components[key] = cd
+	}
+	return r
+}
+
+func (r *testResolver) Resolve(ctx context.Context, repoCtx cdv2.Repository, name, version string) (*cdv2.ComponentDescriptor, error) {
+	key := ctfutils.ComponentKey{Name: name, Version: version}
+	r.mux.Lock()
+	r.resolved[key]++
+	r.mux.Unlock()
+	if r.hook != nil {
+		if err := r.hook(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+	cd, ok := r.components[key]
+	if !ok {
+		return nil, ctf.NotFoundError
+	}
+	return cd.DeepCopy(), nil
+}
+
+func (r *testResolver) ResolveWithBlobResolver(ctx context.Context, repoCtx cdv2.Repository, name, version string) (*cdv2.ComponentDescriptor, ctf.BlobResolver, error) {
+	cd, err := r.Resolve(ctx, repoCtx, name, version)
+	return cd, nil, err
+}
+
+// parseKey parses a component key of the form "name:version".
+func parseKey(id string) ctfutils.ComponentKey {
+	i := strings.LastIndex(id, ":")
+	return ctfutils.ComponentKey{Name: id[:i], Version: id[i+1:]}
+}
+
+// componentKeys returns the keys of all components of the list.
+func componentKeys(list *cdv2.ComponentDescriptorList) []string {
+	keys := make([]string, len(list.Components))
+	for i, cd := range list.Components {
+		keys[i] = ctfutils.ComponentKey{Name: cd.Name, Version: cd.Version}.String()
+	}
+	return keys
+}
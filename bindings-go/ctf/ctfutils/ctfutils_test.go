@@ -0,0 +1,263 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctfutils_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+	"github.com/gardener/component-spec/bindings-go/ctf/ctfutils"
+)
+
+var _ = Describe("ResolveRecursive", func() {
+
+	repoCtx := cdv2.NewOCIRegistryRepository("example.com", "")
+
+	It("should resolve every component of a diamond exactly once", func() {
+		resolver := newTestResolver(map[string][]string{
+			"a:1": {"b:1", "c:1"},
+			"b:1": {"d:1"},
+			"c:1": {"d:1"},
+			"d:1": {},
+		})
+		list, err := ctfutils.ResolveList(context.Background(), resolver, repoCtx, "a", "1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(componentKeys(list)).To(Equal([]string{"a:1", "b:1", "c:1", "d:1"}))
+		for key, count := range resolver.resolved {
+			Expect(count).To(Equal(1), key.String())
+		}
+	})
+
+	It("should report all direct references of a component before their references", func() {
+		graph := map[string][]string{
+			"a:1": {"b:1", "c:1"},
+			"b:1": {"d:1"},
+			"c:1": {"e:1"},
+			"d:1": {"f:1"},
+			"e:1": {},
+			"f:1": {},
+		}
+		for _, concurrency := range []int{1, 4} {
+			list, err := ctfutils.ResolveList(context.Background(), newTestResolver(graph), repoCtx, "a", "1", ctfutils.Concurrency(concurrency))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(componentKeys(list)).To(Equal([]string{"a:1", "b:1", "c:1", "d:1", "f:1", "e:1"}))
+		}
+	})
+
+	It("should report cycles with their reference path", func() {
+		resolver := newTestResolver(map[string][]string{
+			"a:1": {"b:1", "c:1"},
+			"b:1": {},
+			"c:1": {"d:1"},
+			"d:1": {"b:1", "c:1"},
+		})
+		_, err := ctfutils.ResolveList(context.Background(), resolver, repoCtx, "a", "1")
+		cycleErr := &ctfutils.CycleError{}
+		Expect(errors.As(err, &cycleErr)).To(BeTrue())
+		Expect(cycleErr.Path).To(Equal([]ctfutils.ComponentKey{
+			{Name: "a", Version: "1"},
+			{Name: "c", Version: "1"},
+			{Name: "d", Version: "1"},
+			{Name: "c", Version: "1"},
+		}))
+		Expect(cycleErr.Error()).To(Equal("cyclic component reference: a:1 -> c:1 -> d:1 -> c:1"))
+	})
+
+	It("should report cycles through components that are referenced by a previous sibling", func() {
+		resolver := newTestResolver(map[string][]string{
+			"a:1": {"b:1", "c:1"},
+			"b:1": {"c:1"},
+			"c:1": {"b:1"},
+		})
+		_, err := ctfutils.ResolveList(context.Background(), resolver, repoCtx, "a", "1")
+		cycleErr := &ctfutils.CycleError{}
+		Expect(errors.As(err, &cycleErr)).To(BeTrue())
+		Expect(cycleErr.Error()).To(Equal("cyclic component reference: a:1 -> c:1 -> b:1 -> c:1"))
+	})
+
+	It("should only resolve references up to the max depth", func() {
+		resolver := newTestResolver(map[string][]string{
+			"a:1": {"b:1", "c:1"},
+			"b:1": {"c:1"},
+			"c:1": {"d:1"},
+			"d:1": {"e:1"},
+		})
+		list, err := ctfutils.ResolveList(context.Background(), resolver, repoCtx, "a", "1", ctfutils.MaxDepth(2))
+		Expect(err).ToNot(HaveOccurred())
+		// c is first reached in depth 2 via b but its reference is resolved via the shorter path from a.
+		Expect(componentKeys(list)).To(Equal([]string{"a:1", "b:1", "c:1", "d:1"}))
+		Expect(resolver.resolved[ctfutils.ComponentKey{Name: "c", Version: "1"}]).To(Equal(1))
+	})
+
+	It("should stop resolving if the callback requests it", func() {
+		resolver := newTestResolver(map[string][]string{
+			"a:1": {"b:1", "c:1"},
+			"b:1": {},
+			"c:1": {},
+		})
+		resolved := make([]string, 0)
+		Expect(ctfutils.ResolveRecursive(context.Background(), resolver, repoCtx, "a", "1", func(cd *cdv2.ComponentDescriptor) (bool, error) {
+			resolved = append(resolved, cd.Name)
+			return cd.Name == "b", nil
+		})).To(Succeed())
+		Expect(resolved).To(Equal([]string{"a", "b"}))
+	})
+
+})
+
+var _ = Describe("ResolveRecursive with concurrency", func() {
+
+	repoCtx := cdv2.NewOCIRegistryRepository("example.com", "")
+
+	// newLayeredGraph creates a graph with the given number of layers where every component references
+	// all components of the next layer.
+	newLayeredGraph := func(layers, width int) map[string][]string {
+		graph := map[string][]string{}
+		for l := 0; l < layers; l++ {
+			for w := 0; w < width; w++ {
+				refs := make([]string, 0)
+				if l < layers-1 {
+					for n := 0; n < width; n++ {
+						refs = append(refs, fmt.Sprintf("c-%d-%d:1", l+1, (w+n)%width))
+					}
+				}
+				graph[fmt.Sprintf("c-%d-%d:1", l, w)] = refs
+			}
+		}
+		graph["root:1"] = []string{"c-0-0:1", "c-0-1:1"}
+		return graph
+	}
+
+	It("should resolve the same list as the sequential resolve", func() {
+		ctx := context.Background()
+		graph := newLayeredGraph(5, 8)
+		expected, err := ctfutils.ResolveList(ctx, newTestResolver(graph), repoCtx, "root", "1")
+		Expect(err).ToNot(HaveOccurred())
+
+		resolver := newTestResolver(graph)
+		resolver.hook = func(ctx context.Context, key ctfutils.ComponentKey) error {
+			time.Sleep(time.Millisecond)
+			return nil
+		}
+		list, err := ctfutils.ResolveList(ctx, resolver, repoCtx, "root", "1", ctfutils.Concurrency(4))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(componentKeys(list)).To(Equal(componentKeys(expected)))
+		Expect(resolver.resolved).To(HaveLen(len(expected.Components)))
+		for key, count := range resolver.resolved {
+			Expect(count).To(Equal(1), key.String())
+		}
+
+		list, err = ctfutils.ResolveList(ctx, newTestResolver(graph), repoCtx, "root", "1", ctfutils.Concurrency(4), ctfutils.MaxDepth(2))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(list.Components).To(HaveLen(11))
+	})
+
+	It("should report the same errors as the sequential resolve", func() {
+		resolver := newTestResolver(map[string][]string{
+			"a:1": {"b:1", "c:1"},
+			"b:1": {"d:1"},
+			"c:1": {"missing:1"},
+			"d:1": {"b:1"},
+		})
+		_, err := ctfutils.ResolveList(context.Background(), resolver, repoCtx, "a", "1", ctfutils.Concurrency(4))
+		cycleErr := &ctfutils.CycleError{}
+		Expect(errors.As(err, &cycleErr)).To(BeTrue())
+		Expect(cycleErr.Path).To(HaveLen(4))
+	})
+
+	It("should stop all workers if the context is canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		resolver := newTestResolver(newLayeredGraph(2, 4))
+		resolver.hook = func(ctx context.Context, key ctfutils.ComponentKey) error {
+			if key.Name == "root" {
+				return nil
+			}
+			cancel()
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		_, err := ctfutils.ResolveList(ctx, resolver, repoCtx, "root", "1", ctfutils.Concurrency(4))
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+	})
+
+})
+
+var _ = Describe("ResolveRecursive with multiple repositories", func() {
+
+	It("should resolve references in the repository context of the label, the referencing component or the root", func() {
+		root := cdv2.NewOCIRegistryRepository("example.com/root", "")
+		other := cdv2.NewOCIRegistryRepository("example.com/other", "")
+		rootComponents := newTestResolver(map[string][]string{
+			"a:1": {"b:1", "c:1"},
+			"b:1": {"e:1"},
+			"e:1": {},
+		})
+		otherComponents := newTestResolver(map[string][]string{
+			"c:1": {"d:1"},
+			"d:1": {},
+		})
+		a := rootComponents.components[parseKey("a:1")]
+		Expect(cdv2.InjectRepositoryContext(a, root)).To(Succeed())
+		otherLabel, err := json.Marshal(other)
+		Expect(err).ToNot(HaveOccurred())
+		a.ComponentReferences[1].Labels = cdv2.Labels{{Name: ctfutils.RepositoryContextLabel, Value: otherLabel}}
+		Expect(cdv2.InjectRepositoryContext(otherComponents.components[parseKey("c:1")], other)).To(Succeed())
+
+		resolver := repositoryResolver{
+			root.BaseURL:  rootComponents,
+			other.BaseURL: otherComponents,
+		}
+		for _, concurrency := range []int{1, 4} {
+			list, err := ctfutils.ResolveList(context.Background(), resolver, root, "a", "1", ctfutils.Concurrency(concurrency))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(componentKeys(list)).To(Equal([]string{"a:1", "b:1", "c:1", "e:1", "d:1"}))
+		}
+	})
+
+	It("should report invalid repository context labels", func() {
+		resolver := newTestResolver(map[string][]string{
+			"a:1": {"b:1"},
+			"b:1": {},
+		})
+		resolver.components[parseKey("a:1")].ComponentReferences[0].Labels = cdv2.Labels{{Name: ctfutils.RepositoryContextLabel, Value: []byte(`"invalid"`)}}
+		_, err := ctfutils.ResolveList(context.Background(), resolver, cdv2.NewOCIRegistryRepository("example.com", ""), "a", "1")
+		Expect(err).To(HaveOccurred())
+	})
+
+})
+
+// repositoryResolver resolves components from the test resolver of the base url of the oci repository context.
+type repositoryResolver map[string]*testResolver
+
+var _ ctf.ComponentResolver = repositoryResolver{}
+
+func (r repositoryResolver) Resolve(ctx context.Context, repoCtx cdv2.Repository, name, version string) (*cdv2.ComponentDescriptor, error) {
+	data, err := json.Marshal(repoCtx)
+	if err != nil {
+		return nil, err
+	}
+	repo := cdv2.OCIRegistryRepository{}
+	if err := json.Unmarshal(data, &repo); err != nil {
+		return nil, err
+	}
+	resolver, ok := r[repo.BaseURL]
+	if !ok {
+		return nil, ctf.NotFoundError
+	}
+	return resolver.Resolve(ctx, repoCtx, name, version)
+}
+
+func (r repositoryResolver) ResolveWithBlobResolver(ctx context.Context, repoCtx cdv2.Repository, name, version string) (*cdv2.ComponentDescriptor, ctf.BlobResolver, error) {
+	cd, err := r.Resolve(ctx, repoCtx, name, version)
+	return cd, nil, err
+}
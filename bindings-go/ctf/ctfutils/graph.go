@@ -0,0 +1,229 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctfutils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+)
+
+// Edge describes a component reference between two components of a graph.
+type Edge struct {
+	// From is the referencing component.
+	From ComponentKey
+	// To is the referenced component.
+	To ComponentKey
+	// Name is the name of the component reference.
+	Name string
+	// ExtraIdentity is the extra identity of the component reference.
+	ExtraIdentity cdv2.Identity
+}
+
+// Label returns the name of the reference followed by its sorted extra identity.
+func (e Edge) Label() string {
+	if len(e.ExtraIdentity) == 0 {
+		return e.Name
+	}
+	keys := make([]string, 0, len(e.ExtraIdentity))
+	for k := range e.ExtraIdentity {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%s", k, e.ExtraIdentity[k])
+	}
+	return fmt.Sprintf("%s (%s)", e.Name, strings.Join(pairs, ", "))
+}
+
+// Graph describes the components that are transitively referenced by a root component.
+// A graph never contains cycles.
+type Graph struct {
+	// Root is the root component of the graph.
+	Root ComponentKey
+
+	nodes      []ComponentKey
+	components map[ComponentKey]*cdv2.ComponentDescriptor
+	edges      []Edge
+	outgoing   map[ComponentKey][]Edge
+	incoming   map[ComponentKey][]Edge
+}
+
+// BuildGraph recursively resolves the root component and returns the graph of all resolved components.
+// The options are the same as for ResolveRecursive.
+// References to components that are not resolved due to a max depth are not part of the graph.
+func BuildGraph(ctx context.Context, resolver ctf.ComponentResolver, repoCtx cdv2.Repository, name, version string, opts ...ResolveOption) (*Graph, error) {
+	g := &Graph{
+		Root:       ComponentKey{Name: name, Version: version},
+		nodes:      make([]ComponentKey, 0),
+		components: map[ComponentKey]*cdv2.ComponentDescriptor{},
+		edges:      make([]Edge, 0),
+		outgoing:   map[ComponentKey][]Edge{},
+		incoming:   map[ComponentKey][]Edge{},
+	}
+	err := ResolveRecursive(ctx, resolver, repoCtx, name, version, func(cd *cdv2.ComponentDescriptor) (bool, error) {
+		key := ComponentKey{Name: cd.GetName(), Version: cd.GetVersion()}
+		g.nodes = append(g.nodes, key)
+		g.components[key] = cd
+		return false, nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, from := range g.nodes {
+		for _, ref := range g.components[from].ComponentReferences {
+			to := ComponentKey{Name: ref.ComponentName, Version: ref.Version}
+			if _, ok := g.components[to]; !ok {
+				continue
+			}
+			edge := Edge{
+				From:          from,
+				To:            to,
+				Name:          ref.GetName(),
+				ExtraIdentity: ref.ExtraIdentity,
+			}
+			g.edges = append(g.edges, edge)
+			g.outgoing[from] = append(g.outgoing[from], edge)
+			g.incoming[to] = append(g.incoming[to], edge)
+		}
+	}
+	return g, nil
+}
+
+// Nodes returns all components of the graph in the order of ResolveRecursive.
+func (g *Graph) Nodes() []ComponentKey {
+	return append([]ComponentKey{}, g.nodes...)
+}
+
+// Component returns the component descriptor of a component of the graph.
+func (g *Graph) Component(key ComponentKey) (*cdv2.ComponentDescriptor, bool) {
+	cd, ok := g.components[key]
+	return cd, ok
+}
+
+// Edges returns all component references of the graph.
+func (g *Graph) Edges() []Edge {
+	return append([]Edge{}, g.edges...)
+}
+
+// References returns the references of a component.
+func (g *Graph) References(key ComponentKey) []Edge {
+	return append([]Edge{}, g.outgoing[key]...)
+}
+
+// ReferencedBy returns the references of all components that directly reference the component.
+func (g *Graph) ReferencedBy(key ComponentKey) []Edge {
+	return append([]Edge{}, g.incoming[key]...)
+}
+
+// Dependents returns all components that directly or transitively reference the component
+// in the order of ResolveRecursive.
+func (g *Graph) Dependents(key ComponentKey) []ComponentKey {
+	dependents := map[ComponentKey]bool{}
+	queue := []ComponentKey{key}
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, edge := range g.incoming[current] {
+			if !dependents[edge.From] {
+				dependents[edge.From] = true
+				queue = append(queue, edge.From)
+			}
+		}
+	}
+	result := make([]ComponentKey, 0, len(dependents))
+	for _, node := range g.nodes {
+		if dependents[node] {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+// TopologicalOrder returns all components so that every component is listed before the components it references.
+// The root component is always the first component.
+// Components without an order between them are sorted in the order of ResolveRecursive.
+// Use the reverse order to process the references of a component before the component itself.
+func (g *Graph) TopologicalOrder() []ComponentKey {
+	inDegree := map[ComponentKey]int{}
+	for _, edge := range g.edges {
+		inDegree[edge.To]++
+	}
+	index := map[ComponentKey]int{}
+	for i, node := range g.nodes {
+		index[node] = i
+	}
+
+	ready := make([]ComponentKey, 0)
+	for _, node := range g.nodes {
+		if inDegree[node] == 0 {
+			ready = append(ready, node)
+		}
+	}
+	order := make([]ComponentKey, 0, len(g.nodes))
+	for len(ready) != 0 {
+		sort.SliceStable(ready, func(i, j int) bool { return index[ready[i]] < index[ready[j]] })
+		node := ready[0]
+		ready = ready[1:]
+		order = append(order, node)
+		for _, edge := range g.outgoing[node] {
+			inDegree[edge.To]--
+			if inDegree[edge.To] == 0 {
+				ready = append(ready, edge.To)
+			}
+		}
+	}
+	return order
+}
+
+// WriteDOT writes the graph in the graphviz DOT format.
+// The edges are labeled with the name and extra identity of the references.
+func (g *Graph) WriteDOT(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	fmt.Fprintln(w, "digraph components {")
+	for _, node := range g.nodes {
+		fmt.Fprintf(w, "  %s;\n", dotQuote(node.String()))
+	}
+	for _, edge := range g.edges {
+		fmt.Fprintf(w, "  %s -> %s [label=%s];\n", dotQuote(edge.From.String()), dotQuote(edge.To.String()), dotQuote(edge.Label()))
+	}
+	fmt.Fprintln(w, "}")
+	return w.Flush()
+}
+
+// WriteMermaid writes the graph as mermaid flowchart.
+// The edges are labeled with the name and extra identity of the references.
+func (g *Graph) WriteMermaid(writer io.Writer) error {
+	ids := map[ComponentKey]string{}
+	w := bufio.NewWriter(writer)
+	fmt.Fprintln(w, "graph TD")
+	for i, node := range g.nodes {
+		ids[node] = fmt.Sprintf("c%d", i)
+		fmt.Fprintf(w, "  %s[%s]\n", ids[node], mermaidQuote(node.String()))
+	}
+	for _, edge := range g.edges {
+		fmt.Fprintf(w, "  %s -->|%s| %s\n", ids[edge.From], mermaidQuote(edge.Label()), ids[edge.To])
+	}
+	return w.Flush()
+}
+
+// dotQuote returns the value as quoted DOT string.
+func dotQuote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+// mermaidQuote returns the value as quoted mermaid string.
+func mermaidQuote(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, "#quot;") + `"`
+}
@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctfutils_test
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf/ctfutils"
+)
+
+var _ = Describe("Graph", func() {
+
+	repoCtx := cdv2.NewOCIRegistryRepository("example.com", "")
+
+	var graph *ctfutils.Graph
+
+	BeforeEach(func() {
+		resolver := newTestResolver(map[string][]string{
+			"a:1": {"c:1", "b:1"},
+			"b:1": {"c:1"},
+			"c:1": {"d:1"},
+			"d:1": {},
+		})
+		resolver.components[parseKey("a:1")].ComponentReferences[1].ExtraIdentity = cdv2.Identity{"region": "eu", "arch": "amd64"}
+		var err error
+		graph, err = ctfutils.BuildGraph(context.Background(), resolver, repoCtx, "a", "1")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should contain all components and references", func() {
+		Expect(graph.Nodes()).To(Equal([]ctfutils.ComponentKey{parseKey("a:1"), parseKey("c:1"), parseKey("b:1"), parseKey("d:1")}))
+		Expect(graph.Edges()).To(HaveLen(4))
+		refs := graph.References(parseKey("a:1"))
+		Expect(refs).To(HaveLen(2))
+		Expect(refs[1].To).To(Equal(parseKey("b:1")))
+		Expect(refs[1].Label()).To(Equal("ref-b (arch=amd64, region=eu)"))
+	})
+
+	It("should order components topologically", func() {
+		Expect(graph.TopologicalOrder()).To(Equal([]ctfutils.ComponentKey{parseKey("a:1"), parseKey("b:1"), parseKey("c:1"), parseKey("d:1")}))
+	})
+
+	It("should return the reverse dependencies of a component", func() {
+		referencedBy := graph.ReferencedBy(parseKey("c:1"))
+		Expect(referencedBy).To(HaveLen(2))
+		Expect(referencedBy[0].From).To(Equal(parseKey("a:1")))
+		Expect(referencedBy[1].From).To(Equal(parseKey("b:1")))
+		Expect(graph.Dependents(parseKey("d:1"))).To(Equal([]ctfutils.ComponentKey{parseKey("a:1"), parseKey("c:1"), parseKey("b:1")}))
+		Expect(graph.Dependents(parseKey("a:1"))).To(BeEmpty())
+	})
+
+	It("should export the graph as DOT and mermaid", func() {
+		var dot bytes.Buffer
+		Expect(graph.WriteDOT(&dot)).To(Succeed())
+		Expect(dot.String()).To(Equal(`digraph components {
+  "a:1";
+  "c:1";
+  "b:1";
+  "d:1";
+  "a:1" -> "c:1" [label="ref-c"];
+  "a:1" -> "b:1" [label="ref-b (arch=amd64, region=eu)"];
+  "c:1" -> "d:1" [label="ref-d"];
+  "b:1" -> "c:1" [label="ref-c"];
+}
+`))
+
+		var mermaid bytes.Buffer
+		Expect(graph.WriteMermaid(&mermaid)).To(Succeed())
+		Expect(mermaid.String()).To(Equal(`graph TD
+  c0["a:1"]
+  c1["c:1"]
+  c2["b:1"]
+  c3["d:1"]
+  c0 -->|"ref-c"| c1
+  c0 -->|"ref-b (arch=amd64, region=eu)"| c2
+  c1 -->|"ref-d"| c3
+  c2 -->|"ref-c"| c1
+`))
+	})
+
+})
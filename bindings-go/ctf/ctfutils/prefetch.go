@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctfutils
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+)
+
+// prefetcher resolves components with a pool of workers.
+// Whenever a component is resolved, its references are scheduled to be resolved, too.
+// Every component is resolved at most once per repository context.
+type prefetcher struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	resolver    ctf.ComponentResolver
+	rootRepoCtx cdv2.Repository
+	maxDepth    int
+
+	mux     sync.Mutex
+	cond    *sync.Cond
+	futures map[futureKey]*future
+	queue   []*future
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// futureKey identifies a component in a repository context.
+type futureKey struct {
+	ComponentKey
+	repoCtx string
+}
+
+// future is a component that is scheduled to be resolved.
+type future struct {
+	key     ComponentKey
+	repoCtx cdv2.Repository
+	// depth is the minimal depth in which the component has been scheduled.
+	depth int
+	done  chan struct{}
+	cd    *cdv2.ComponentDescriptor
+	err   error
+}
+
+// newPrefetcher creates a prefetcher and starts the configured number of workers.
+// The prefetcher has to be closed to stop the workers.
+func newPrefetcher(ctx context.Context, resolver ctf.ComponentResolver, repoCtx cdv2.Repository, options *ResolveOptions) *prefetcher {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &prefetcher{
+		ctx:         ctx,
+		cancel:      cancel,
+		resolver:    resolver,
+		rootRepoCtx: repoCtx,
+		maxDepth:    options.MaxDepth,
+		futures:     map[futureKey]*future{},
+	}
+	p.cond = sync.NewCond(&p.mux)
+	for w := 0; w < options.Concurrency; w++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Get returns the resolved component and schedules it in the given depth if it has not been scheduled yet.
+func (p *prefetcher) Get(ctx context.Context, repoCtx cdv2.Repository, name, version string, depth int) (*cdv2.ComponentDescriptor, error) {
+	p.mux.Lock()
+	f := p.schedule(repoCtx, ComponentKey{Name: name, Version: version}, depth)
+	p.mux.Unlock()
+	select {
+	case <-f.done:
+		return f.cd, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close cancels all running resolves and waits until all workers are stopped.
+func (p *prefetcher) Close() {
+	p.mux.Lock()
+	p.closed = true
+	p.mux.Unlock()
+	p.cancel()
+	p.cond.Broadcast()
+	p.wg.Wait()
+}
+
+// schedule adds the component to the queue if it has not been scheduled yet.
+// The lock has to be held by the caller.
+func (p *prefetcher) schedule(repoCtx cdv2.Repository, key ComponentKey, depth int) *future {
+	fkey := futureKey{ComponentKey: key}
+	if data, err := json.Marshal(repoCtx); err == nil {
+		fkey.repoCtx = string(data)
+	}
+	if f, ok := p.futures[fkey]; ok {
+		if depth < f.depth {
+			f.depth = depth
+		}
+		return f
+	}
+	f := &future{
+		key:     key,
+		repoCtx: repoCtx,
+		depth:   depth,
+		done:    make(chan struct{}),
+	}
+	p.futures[fkey] = f
+	p.queue = append(p.queue, f)
+	p.cond.Signal()
+	return f
+}
+
+// work resolves scheduled components until the prefetcher is closed.
+func (p *prefetcher) work() {
+	defer p.wg.Done()
+	for {
+		p.mux.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if p.closed {
+			p.mux.Unlock()
+			return
+		}
+		f := p.queue[0]
+		p.queue = p.queue[1:]
+		p.mux.Unlock()
+
+		f.cd, f.err = p.resolver.Resolve(p.ctx, f.repoCtx, f.key.Name, f.key.Version)
+		if f.err == nil {
+			p.mux.Lock()
+			if p.maxDepth == 0 || f.depth < p.maxDepth {
+				for _, ref := range f.cd.ComponentReferences {
+					// invalid repository contexts are reported when the reference is visited.
+					if repoCtx, err := ReferenceRepositoryContext(p.rootRepoCtx, f.cd, ref); err == nil {
+						p.schedule(repoCtx, ComponentKey{Name: ref.ComponentName, Version: ref.Version}, f.depth+1)
+					}
+				}
+			}
+			p.mux.Unlock()
+		}
+		close(f.done)
+	}
+}
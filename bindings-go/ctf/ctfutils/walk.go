@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctfutils
+
+import (
+	"context"
+	"fmt"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+	"github.com/gardener/component-spec/bindings-go/utils/selector"
+)
+
+// WalkContext describes a component of a recursively resolved component graph.
+type WalkContext struct {
+	// Component is the component descriptor of the component.
+	Component *cdv2.ComponentDescriptor
+	// RepositoryContext is the repository context the component has been resolved in.
+	RepositoryContext cdv2.Repository
+	// Path contains the component references that have been followed from the root to the component.
+	// The path is empty for the root component.
+	Path []cdv2.ComponentReference
+}
+
+// ResourceWalkFunc is called for every walked resource with the context of its component.
+// The function can optionally return true to stop the walk.
+type ResourceWalkFunc func(wctx WalkContext, res cdv2.Resource) (stop bool, err error)
+
+// SourceWalkFunc is called for every walked source with the context of its component.
+// The function can optionally return true to stop the walk.
+type SourceWalkFunc func(wctx WalkContext, src cdv2.Source) (stop bool, err error)
+
+// ApplyWalkOption configures the function to also walk the sources.
+func (f SourceWalkFunc) ApplyWalkOption(options *WalkOptions) {
+	options.SourceFunc = f
+}
+
+// WalkOptions defines the options for walking the resources and sources of a component graph.
+type WalkOptions struct {
+	// IdentitySelectors select the resources and sources by their identity.
+	IdentitySelectors []cdv2.IdentitySelector
+	// ResourceSelectors additionally select the resources.
+	ResourceSelectors []cdv2.ResourceSelectorFunc
+	// SourceFunc is optionally called for all selected sources.
+	SourceFunc SourceWalkFunc
+	// ResolveOptions are the options of the recursive resolve of the components.
+	ResolveOptions []ResolveOption
+}
+
+// ApplyOptions applies the given list options on these options,
+// and then returns itself (for convenient chaining).
+func (o *WalkOptions) ApplyOptions(opts []WalkOption) *WalkOptions {
+	for _, opt := range opts {
+		if opt != nil {
+			opt.ApplyWalkOption(o)
+		}
+	}
+	return o
+}
+
+// WalkOption is the interface to specify different walk options.
+type WalkOption interface {
+	ApplyWalkOption(options *WalkOptions)
+}
+
+// IdentitySelectors selects the walked resources and sources by their identity.
+type IdentitySelectors []cdv2.IdentitySelector
+
+// ApplyWalkOption applies the configured selectors.
+func (s IdentitySelectors) ApplyWalkOption(options *WalkOptions) {
+	options.IdentitySelectors = append(options.IdentitySelectors, s...)
+}
+
+// ResourceSelectors selects the walked resources.
+type ResourceSelectors []cdv2.ResourceSelectorFunc
+
+// ApplyWalkOption applies the configured selectors.
+func (s ResourceSelectors) ApplyWalkOption(options *WalkOptions) {
+	options.ResourceSelectors = append(options.ResourceSelectors, s...)
+}
+
+// WalkResolveOptions defines the options of the recursive resolve of the components.
+type WalkResolveOptions []ResolveOption
+
+// ApplyWalkOption applies the configured resolve options.
+func (r WalkResolveOptions) ApplyWalkOption(options *WalkOptions) {
+	options.ResolveOptions = append(options.ResolveOptions, r...)
+}
+
+// WalkResources recursively resolves the root component and calls the given function
+// for every resource of every component that matches the configured selectors.
+// The components are walked in the order of ResolveRecursive and the resources in the order of the component descriptor.
+// If a SourceWalkFunc is configured, it is called for the matching sources of a component after its resources.
+// The resource function may be nil to only walk the sources.
+func WalkResources(ctx context.Context, resolver ctf.ComponentResolver, repoCtx cdv2.Repository, name, version string, fn ResourceWalkFunc, opts ...WalkOption) error {
+	options := (&WalkOptions{}).ApplyOptions(opts)
+	return resolveRecursive(ctx, resolver, repoCtx, name, version, func(wctx WalkContext) (bool, error) {
+		if fn != nil {
+			for _, res := range wctx.Component.Resources {
+				ok, err := matchResource(res, options)
+				if err != nil {
+					return false, err
+				}
+				if !ok {
+					continue
+				}
+				if stop, err := fn(wctx, res); err != nil || stop {
+					return stop, err
+				}
+			}
+		}
+		if options.SourceFunc != nil {
+			for _, src := range wctx.Component.Sources {
+				ok, err := selector.MatchSelectors(src.GetIdentity(), options.IdentitySelectors...)
+				if err != nil {
+					return false, fmt.Errorf("unable to match selector for source %s: %w", src.GetName(), err)
+				}
+				if !ok {
+					continue
+				}
+				if stop, err := options.SourceFunc(wctx, src); err != nil || stop {
+					return stop, err
+				}
+			}
+		}
+		return false, nil
+	}, options.ResolveOptions...)
+}
+
+// matchResource returns whether the resource matches all configured selectors.
+func matchResource(res cdv2.Resource, options *WalkOptions) (bool, error) {
+	ok, err := selector.MatchSelectors(res.GetIdentity(), options.IdentitySelectors...)
+	if err != nil {
+		return false, fmt.Errorf("unable to match selector for resource %s: %w", res.GetName(), err)
+	}
+	if !ok {
+		return false, nil
+	}
+	ok, err = cdv2.MatchResourceSelectorFuncs(res, options.ResourceSelectors...)
+	if err != nil {
+		return false, fmt.Errorf("unable to match selector for resource %s: %w", res.GetName(), err)
+	}
+	return ok, nil
+}
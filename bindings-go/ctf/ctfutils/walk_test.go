@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctfutils_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf/ctfutils"
+	"github.com/gardener/component-spec/bindings-go/utils/selector"
+)
+
+var _ = Describe("walk", func() {
+
+	var (
+		ctx      context.Context
+		repoCtx  cdv2.Repository
+		resolver *testResolver
+	)
+
+	// addResource adds a resource and a source with the same name to the component.
+	addResource := func(id, name, ttype string) {
+		cd := resolver.components[parseKey(id)]
+		cd.Resources = append(cd.Resources, cdv2.Resource{
+			IdentityObjectMeta: cdv2.IdentityObjectMeta{Name: name, Version: "1.0.0", Type: ttype},
+			Relation:           cdv2.ExternalRelation,
+		})
+		cd.Sources = append(cd.Sources, cdv2.Source{
+			IdentityObjectMeta: cdv2.IdentityObjectMeta{Name: name, Version: "1.0.0", Type: "git"},
+		})
+	}
+
+	// refNames returns the names of the references of a path.
+	refNames := func(refs []cdv2.ComponentReference) []string {
+		names := make([]string, len(refs))
+		for i, ref := range refs {
+			names[i] = ref.GetName()
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		repoCtx = cdv2.NewOCIRegistryRepository("example.com/components", "")
+		resolver = newTestResolver(map[string][]string{
+			"a:1": {"b:1", "c:1"},
+			"b:1": {"c:1"},
+			"c:1": {},
+		})
+		addResource("a:1", "config", "json")
+		addResource("b:1", "image", cdv2.OCIImageType)
+		addResource("c:1", "image", cdv2.OCIImageType)
+		addResource("c:1", "chart", "helm")
+	})
+
+	It("should walk all resources of the graph with their reference path", func() {
+		walked := make([]string, 0)
+		paths := map[string][]string{}
+		err := ctfutils.WalkResources(ctx, resolver, repoCtx, "a", "1", func(wctx ctfutils.WalkContext, res cdv2.Resource) (bool, error) {
+			id := fmt.Sprintf("%s/%s", wctx.Component.GetName(), res.GetName())
+			walked = append(walked, id)
+			paths[id] = refNames(wctx.Path)
+			Expect(wctx.RepositoryContext).To(Equal(repoCtx))
+			return false, nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(walked).To(Equal([]string{"a/config", "b/image", "c/image", "c/chart"}))
+		Expect(paths["a/config"]).To(BeEmpty())
+		Expect(paths["b/image"]).To(Equal([]string{"ref-b"}))
+		// c is first reached as direct reference of a.
+		Expect(paths["c/chart"]).To(Equal([]string{"ref-c"}))
+	})
+
+	It("should only walk resources that match the selectors", func() {
+		walked := make([]string, 0)
+		err := ctfutils.WalkResources(ctx, resolver, repoCtx, "a", "1", func(wctx ctfutils.WalkContext, res cdv2.Resource) (bool, error) {
+			walked = append(walked, fmt.Sprintf("%s/%s", wctx.Component.GetName(), res.GetName()))
+			return false, nil
+		},
+			ctfutils.ResourceSelectors{cdv2.NewTypeResourceSelector(cdv2.OCIImageType)},
+			ctfutils.IdentitySelectors{selector.DefaultSelector{cdv2.SystemIdentityName: "image"}},
+			ctfutils.WalkResolveOptions{ctfutils.MaxDepth(1)})
+		Expect(err).ToNot(HaveOccurred())
+		// c is resolved with depth 1 as direct reference of a.
+		Expect(walked).To(Equal([]string{"b/image", "c/image"}))
+	})
+
+	It("should walk sources and stop if requested", func() {
+		walked := make([]string, 0)
+		err := ctfutils.WalkResources(ctx, resolver, repoCtx, "a", "1", nil,
+			ctfutils.SourceWalkFunc(func(wctx ctfutils.WalkContext, src cdv2.Source) (bool, error) {
+				walked = append(walked, fmt.Sprintf("%s/%s", wctx.Component.GetName(), src.GetName()))
+				return len(walked) == 3, nil
+			}))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(walked).To(Equal([]string{"a/config", "b/image", "c/image"}))
+	})
+
+})
@@ -0,0 +1,296 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/mandelsoft/vfs/pkg/projectionfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	"github.com/opencontainers/go-digest"
+
+	v2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+)
+
+const (
+	// MediaTypeTar is the media type of directory blobs that are packed as tar.
+	MediaTypeTar = "application/x-tar"
+	// MediaTypeTarGzip is the media type of directory blobs that are packed as gzipped tar.
+	MediaTypeTarGzip = "application/gzip"
+)
+
+// DirectoryOptions defines how a directory is packed into a blob.
+type DirectoryOptions struct {
+	// Format is the format of the blob.
+	// Only ArchiveFormatTar and ArchiveFormatTarGzip are supported, defaults to ArchiveFormatTarGzip.
+	Format ArchiveFormat
+	// IncludePatterns are patterns of the files that are included.
+	// All files are included if no pattern is defined.
+	IncludePatterns []string
+	// ExcludePatterns are patterns of the files that are excluded.
+	// Exclude patterns take precedence over include patterns.
+	ExcludePatterns []string
+}
+
+// mediaType returns the media type of the blob.
+func (o DirectoryOptions) mediaType() (string, error) {
+	switch o.Format {
+	case ArchiveFormatTar:
+		return MediaTypeTar, nil
+	case "", ArchiveFormatTarGzip:
+		return MediaTypeTarGzip, nil
+	default:
+		return "", fmt.Errorf("unsupported directory blob format %q", o.Format)
+	}
+}
+
+// AddResourceFromDirectory packs the directory at the given path as blob and adds it as resource to the archive.
+// The path may also be a glob pattern, then all matching files and directories are packed
+// relative to the longest directory of the pattern that does not contain any meta characters.
+// The blob is packed deterministically, so that the same content always results in the same digest.
+// If the specified resource already exists it will be overwritten.
+func (ca *ComponentArchive) AddResourceFromDirectory(res *v2.Resource, fs vfs.FileSystem, dirpath string, opts DirectoryOptions) error {
+	info, data, err := packDirectoryBlob(fs, dirpath, opts)
+	if err != nil {
+		return err
+	}
+	return ca.AddResource(res, *info, bytes.NewReader(data))
+}
+
+// AddSourceFromDirectory packs the directory at the given path as blob and adds it as source to the archive.
+// See AddResourceFromDirectory for the supported paths.
+// If the specified source already exists it will be overwritten.
+func (ca *ComponentArchive) AddSourceFromDirectory(src *v2.Source, fs vfs.FileSystem, dirpath string, opts DirectoryOptions) error {
+	info, data, err := packDirectoryBlob(fs, dirpath, opts)
+	if err != nil {
+		return err
+	}
+	return ca.AddSource(src, *info, bytes.NewReader(data))
+}
+
+// packDirectoryBlob packs the directory at the given path and returns the packed blob.
+func packDirectoryBlob(fs vfs.FileSystem, dirpath string, opts DirectoryOptions) (*BlobInfo, []byte, error) {
+	mediaType, err := opts.mediaType()
+	if err != nil {
+		return nil, nil, err
+	}
+	root, pattern := splitGlob(dirpath)
+	if len(pattern) != 0 {
+		opts.IncludePatterns = append([]string{pattern}, opts.IncludePatterns...)
+	}
+	var buf bytes.Buffer
+	if err := WriteDirectory(&buf, fs, root, opts); err != nil {
+		return nil, nil, fmt.Errorf("unable to pack %q: %w", dirpath, err)
+	}
+	return &BlobInfo{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(buf.Bytes()).String(),
+		Size:      int64(buf.Len()),
+	}, buf.Bytes(), nil
+}
+
+// splitGlob splits a path into the longest directory without glob meta characters
+// and the remaining pattern relative to this directory.
+func splitGlob(p string) (string, string) {
+	p = path.Clean(p)
+	elems := strings.Split(p, "/")
+	for i, elem := range elems {
+		if strings.ContainsAny(elem, "*?[\\") {
+			root := strings.Join(elems[:i], "/")
+			if len(root) == 0 {
+				root = "/"
+				if !strings.HasPrefix(p, "/") {
+					root = "."
+				}
+			}
+			return root, strings.Join(elems[i:], "/")
+		}
+	}
+	return p, ""
+}
+
+// WriteDirectory writes the content of the directory as tar or gzipped tar to the writer.
+// Entries are written in reproducible mode relative to the directory.
+// An UnsafeArchiveError is returned for symbolic links that point outside of the directory.
+func WriteDirectory(writer io.Writer, fs vfs.FileSystem, dirpath string, opts DirectoryOptions) error {
+	if _, err := opts.mediaType(); err != nil {
+		return err
+	}
+	for _, pattern := range append(append([]string{}, opts.IncludePatterns...), opts.ExcludePatterns...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	info, err := fs.Stat(dirpath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%q is not a directory", dirpath)
+	}
+
+	options := &WriteOptions{Reproducible: true}
+	if opts.Format == ArchiveFormatTar {
+		return writeDirectoryTar(writer, fs, dirpath, opts, options)
+	}
+	gw := options.newGzipWriter(writer)
+	if err := writeDirectoryTar(gw, fs, dirpath, opts, options); err != nil {
+		_ = gw.Close()
+		return err
+	}
+	return gw.Close()
+}
+
+// writeDirectoryTar writes the content of the directory as tar to the writer.
+func writeDirectoryTar(writer io.Writer, fs vfs.FileSystem, dirpath string, opts DirectoryOptions, options *WriteOptions) error {
+	tw := tar.NewWriter(writer)
+	if err := writeDirectory(tw, fs, dirpath, "", opts, options); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// writeDirectory recursively writes all included entries of the directory to the tar writer.
+// Directories are only written if they are included themselves or contain included entries.
+func writeDirectory(tw *tar.Writer, fs vfs.FileSystem, root, rel string, opts DirectoryOptions, options *WriteOptions) error {
+	infos, err := vfs.ReadDir(fs, vfs.Join(fs, root, rel))
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		name := path.Join(rel, info.Name())
+		if matchesPattern(name, opts.ExcludePatterns) {
+			continue
+		}
+		included := len(opts.IncludePatterns) == 0 || matchesPattern(name, opts.IncludePatterns)
+		filepath := vfs.Join(fs, root, name)
+		header := &tar.Header{
+			Name: name,
+			Mode: int64(info.Mode().Perm()),
+		}
+		switch {
+		case info.IsDir():
+			if !included && !hasIncludedEntries(fs, root, name, opts) {
+				continue
+			}
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+			options.normalizeHeader(header)
+			if err := tw.WriteHeader(header); err != nil {
+				return fmt.Errorf("unable to write header for %q: %w", name, err)
+			}
+			if err := writeDirectory(tw, fs, root, name, opts, options); err != nil {
+				return err
+			}
+		case !included:
+			continue
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := fs.Readlink(filepath)
+			if err != nil {
+				return fmt.Errorf("unable to read link %q: %w", name, err)
+			}
+			// links that point outside of the directory could not be extracted again.
+			if err := checkLinkTarget(name, link); err != nil {
+				return err
+			}
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = link
+			options.normalizeHeader(header)
+			if err := tw.WriteHeader(header); err != nil {
+				return fmt.Errorf("unable to write header for %q: %w", name, err)
+			}
+		case info.Mode().IsRegular():
+			header.Typeflag = tar.TypeReg
+			header.Size = info.Size()
+			options.normalizeHeader(header)
+			if err := writeFile(tw, fs, filepath, header); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFile writes the header and the content of the file to the tar writer.
+func writeFile(tw *tar.Writer, fs vfs.FileSystem, filepath string, header *tar.Header) error {
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("unable to write header for %q: %w", header.Name, err)
+	}
+	file, err := fs.Open(filepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(tw, file); err != nil {
+		return fmt.Errorf("unable to write %q: %w", header.Name, err)
+	}
+	return nil
+}
+
+// hasIncludedEntries returns whether the directory contains any included entries.
+func hasIncludedEntries(fs vfs.FileSystem, root, rel string, opts DirectoryOptions) bool {
+	infos, err := vfs.ReadDir(fs, vfs.Join(fs, root, rel))
+	if err != nil {
+		return false
+	}
+	for _, info := range infos {
+		name := path.Join(rel, info.Name())
+		if matchesPattern(name, opts.ExcludePatterns) {
+			continue
+		}
+		if matchesPattern(name, opts.IncludePatterns) {
+			return true
+		}
+		if info.IsDir() && hasIncludedEntries(fs, root, name, opts) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesPattern returns whether the slash separated path or one of its parent directories matches any of the patterns.
+func matchesPattern(name string, patterns []string) bool {
+	for p := name; p != "." && p != "/" && len(p) != 0; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ExtractDirectoryBlob resolves a blob that has been packed from a directory
+// and extracts its content to the given path of the filesystem.
+// Gzipped and uncompressed tars are supported.
+func ExtractDirectoryBlob(ctx context.Context, resolver BlobResolver, res v2.Resource, fs vfs.FileSystem, dirpath string) error {
+	var buf bytes.Buffer
+	if _, err := resolver.Resolve(ctx, res, &buf); err != nil {
+		return fmt.Errorf("unable to resolve blob of %q: %w", res.GetName(), err)
+	}
+	reader, _, err := NewDecompressingReader(&buf)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if err := fs.MkdirAll(dirpath, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create directory %q: %w", dirpath, err)
+	}
+	dirFs, err := projectionfs.New(fs, dirpath)
+	if err != nil {
+		return fmt.Errorf("unable to create fs for %q: %w", dirpath, err)
+	}
+	if err := ExtractTarToFs(dirFs, reader); err != nil {
+		return fmt.Errorf("unable to extract blob of %q: %w", res.GetName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/mandelsoft/vfs/pkg/vfs"
+)
+
+// UnsafeArchiveError is returned if an archive contains entries that would be written outside of the target
+// or if it exceeds the configured limits.
+// Such archives are most likely crafted on purpose.
+var UnsafeArchiveError = errors.New("UnsafeArchive")
+
+// CorruptedArchiveError is returned if an archive cannot be read.
+var CorruptedArchiveError = errors.New("CorruptedArchive")
+
+// UnsupportedEntryError is returned if an archive contains entries of a type that cannot be extracted,
+// e.g. hard links or devices.
+var UnsupportedEntryError = errors.New("UnsupportedEntry")
+
+// ExtractOptions defines limits for the extraction of archives.
+// A limit of 0 disables the limit.
+type ExtractOptions struct {
+	// MaxTotalSize is the maximal sum of the sizes of all extracted files.
+	MaxTotalSize int64
+	// MaxFileSize is the maximal size of a single extracted file.
+	MaxFileSize int64
+	// MaxEntries is the maximal number of entries of the archive.
+	MaxEntries int
+}
+
+// ApplyOptions applies the given list options on these options,
+// and then returns itself (for convenient chaining).
+func (o *ExtractOptions) ApplyOptions(opts []ExtractOption) *ExtractOptions {
+	for _, opt := range opts {
+		if opt != nil {
+			opt.ApplyExtractOption(o)
+		}
+	}
+	return o
+}
+
+// ExtractOption is the interface to specify different extract options.
+type ExtractOption interface {
+	ApplyExtractOption(options *ExtractOptions)
+}
+
+// MaxTotalSize limits the sum of the sizes of all extracted files.
+type MaxTotalSize int64
+
+// ApplyExtractOption applies the configured limit.
+func (s MaxTotalSize) ApplyExtractOption(options *ExtractOptions) {
+	options.MaxTotalSize = int64(s)
+}
+
+// MaxFileSize limits the size of a single extracted file.
+type MaxFileSize int64
+
+// ApplyExtractOption applies the configured limit.
+func (s MaxFileSize) ApplyExtractOption(options *ExtractOptions) {
+	options.MaxFileSize = int64(s)
+}
+
+// MaxEntries limits the number of entries of an archive.
+type MaxEntries int
+
+// ApplyExtractOption applies the configured limit.
+func (n MaxEntries) ApplyExtractOption(options *ExtractOptions) {
+	options.MaxEntries = int(n)
+}
+
+// ExtractTarToFs writes a tar stream to a filesystem.
+// Absolute entry names are extracted relative to the root of the filesystem.
+// An UnsafeArchiveError is returned for entries and link targets that escape the root of the filesystem
+// and if one of the configured limits is exceeded,
+// a CorruptedArchiveError is returned if the tar cannot be read
+// and an UnsupportedEntryError is returned for entries other than directories, regular files and symbolic links.
+func ExtractTarToFs(fs vfs.FileSystem, in io.Reader, opts ...ExtractOption) error {
+	options := (&ExtractOptions{}).ApplyOptions(opts)
+	var (
+		entries   int
+		totalSize int64
+	)
+	tr := tar.NewReader(in)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("%w: %s", CorruptedArchiveError, err.Error())
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			// global pax headers only contain metadata for the following entries.
+			continue
+		}
+
+		entries++
+		if options.MaxEntries > 0 && entries > options.MaxEntries {
+			return fmt.Errorf("%w: archive contains more than %d entries", UnsafeArchiveError, options.MaxEntries)
+		}
+		name, err := extractPath(header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := fs.MkdirAll(name, os.FileMode(header.Mode)); err != nil {
+				return fmt.Errorf("unable to create directory %s: %w", header.Name, err)
+			}
+		case tar.TypeReg:
+			if options.MaxFileSize > 0 && header.Size > options.MaxFileSize {
+				return fmt.Errorf("%w: file %q exceeds the maximal size of %d bytes", UnsafeArchiveError, header.Name, options.MaxFileSize)
+			}
+			totalSize += header.Size
+			if options.MaxTotalSize > 0 && totalSize > options.MaxTotalSize {
+				return fmt.Errorf("%w: archive exceeds the maximal size of %d bytes", UnsafeArchiveError, options.MaxTotalSize)
+			}
+			if err := extractFile(fs, name, header, tr); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := checkLinkTarget(name, header.Linkname); err != nil {
+				return err
+			}
+			if err := fs.Symlink(header.Linkname, name); err != nil {
+				return fmt.Errorf("unable to create symbolic link %s: %w", header.Name, err)
+			}
+		default:
+			return fmt.Errorf("%w: %q has unsupported type %q", UnsupportedEntryError, header.Name, string(header.Typeflag))
+		}
+	}
+}
+
+// extractFile writes the content of the current tar entry to the file.
+func extractFile(fs vfs.FileSystem, name string, header *tar.Header, tr *tar.Reader) error {
+	file, err := fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(header.Mode))
+	if err != nil {
+		return fmt.Errorf("unable to open file %s: %w", header.Name, err)
+	}
+	reader := &errorRecordingReader{reader: tr}
+	if _, err := io.Copy(file, reader); err != nil {
+		_ = file.Close()
+		if reader.err != nil {
+			return fmt.Errorf("%w: unable to read %s: %s", CorruptedArchiveError, header.Name, reader.err.Error())
+		}
+		return fmt.Errorf("unable to copy tar file to filesystem: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("unable to close file %s: %w", header.Name, err)
+	}
+	return nil
+}
+
+// errorRecordingReader records read errors to distinguish them from write errors.
+type errorRecordingReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *errorRecordingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// extractPath returns the clean path of an entry relative to the root of the target.
+// An UnsafeArchiveError is returned if the entry escapes the root.
+func extractPath(name string) (string, error) {
+	if strings.ContainsRune(name, 0) {
+		return "", fmt.Errorf("%w: entry name %q contains a null character", UnsafeArchiveError, name)
+	}
+	clean := path.Clean(strings.TrimLeft(name, "/"))
+	if escapes(clean) {
+		return "", fmt.Errorf("%w: entry %q is outside of the archive root", UnsafeArchiveError, name)
+	}
+	return clean, nil
+}
+
+// checkLinkTarget returns an UnsafeArchiveError if the target of a symbolic link is outside of the archive root.
+func checkLinkTarget(name, target string) error {
+	if path.IsAbs(target) || escapes(path.Join(path.Dir(name), target)) {
+		return fmt.Errorf("%w: link %q points outside of the archive root to %q", UnsafeArchiveError, name, target)
+	}
+	return nil
+}
+
+// escapes returns whether a clean relative path points outside of its root.
+func escapes(clean string) bool {
+	return clean == ".." || strings.HasPrefix(clean, "../")
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+
+	"github.com/mandelsoft/vfs/pkg/memoryfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/component-spec/bindings-go/ctf"
+)
+
+var _ = Describe("Extract", func() {
+
+	It("should extract files, directories and symbolic links", func() {
+		data := newTar(
+			&tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: map[string]string{"comment": "test"}},
+			&tar.Header{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0755},
+			&tar.Header{Typeflag: tar.TypeReg, Name: "/dir/file", Mode: 0644, Size: 4},
+			&tar.Header{Typeflag: tar.TypeSymlink, Name: "dir/link", Linkname: "file"},
+		)
+		fs := memoryfs.New()
+		Expect(ctf.ExtractTarToFs(fs, bytes.NewReader(data))).To(Succeed())
+		Expect(vfs.ReadFile(fs, "/dir/file")).To(Equal([]byte("data")))
+		Expect(fs.Readlink("/dir/link")).To(Equal("file"))
+	})
+
+	It("should reject entries outside of the root", func() {
+		data := newTar(&tar.Header{Typeflag: tar.TypeReg, Name: "dir/../../evil", Mode: 0644, Size: 4})
+		err := ctf.ExtractTarToFs(memoryfs.New(), bytes.NewReader(data))
+		Expect(errors.Is(err, ctf.UnsafeArchiveError)).To(BeTrue())
+	})
+
+	It("should reject symbolic links that point outside of the root", func() {
+		for _, target := range []string{"/etc/passwd", "../../etc/passwd"} {
+			data := newTar(&tar.Header{Typeflag: tar.TypeSymlink, Name: "dir/link", Linkname: target})
+			err := ctf.ExtractTarToFs(memoryfs.New(), bytes.NewReader(data))
+			Expect(errors.Is(err, ctf.UnsafeArchiveError)).To(BeTrue(), target)
+		}
+	})
+
+	It("should enforce the configured limits", func() {
+		data := newTar(
+			&tar.Header{Typeflag: tar.TypeReg, Name: "a", Mode: 0644, Size: 4},
+			&tar.Header{Typeflag: tar.TypeReg, Name: "b", Mode: 0644, Size: 4},
+		)
+		Expect(ctf.ExtractTarToFs(memoryfs.New(), bytes.NewReader(data), ctf.MaxFileSize(4), ctf.MaxTotalSize(8), ctf.MaxEntries(2))).To(Succeed())
+
+		for _, opt := range []ctf.ExtractOption{ctf.MaxFileSize(3), ctf.MaxTotalSize(7), ctf.MaxEntries(1)} {
+			err := ctf.ExtractTarToFs(memoryfs.New(), bytes.NewReader(data), opt)
+			Expect(errors.Is(err, ctf.UnsafeArchiveError)).To(BeTrue(), "%#v", opt)
+		}
+	})
+
+	It("should report unsupported entry types", func() {
+		data := newTar(&tar.Header{Typeflag: tar.TypeLink, Name: "link", Linkname: "file"})
+		err := ctf.ExtractTarToFs(memoryfs.New(), bytes.NewReader(data))
+		Expect(errors.Is(err, ctf.UnsupportedEntryError)).To(BeTrue())
+	})
+
+	It("should report corrupted archives", func() {
+		data := newTar(&tar.Header{Typeflag: tar.TypeReg, Name: "file", Mode: 0644, Size: 4})
+		err := ctf.ExtractTarToFs(memoryfs.New(), bytes.NewReader(data[:514]))
+		Expect(errors.Is(err, ctf.CorruptedArchiveError)).To(BeTrue())
+		Expect(errors.Is(err, ctf.UnsafeArchiveError)).To(BeFalse())
+	})
+
+	It("should apply the limits to the decompressed component archives of a ctf", func() {
+		fs := memoryfs.New()
+		ctfArchive := newTestCTF(fs, "/ctf.tar")
+		a := newTestComponentArchive("example.com/a", "0.0.0")
+		addTestBlob(a, "res", make([]byte, 100*1024))
+		Expect(ctfArchive.AddComponentArchive(a, ctf.ArchiveFormatTarGzip)).To(Succeed())
+		Expect(ctfArchive.Write()).To(Succeed())
+		Expect(ctfArchive.Close()).To(Succeed())
+
+		ctfArchive, err := ctf.NewCTF(fs, "/ctf.tar", ctf.MaxTotalSize(10*1024))
+		Expect(err).ToNot(HaveOccurred())
+		defer ctfArchive.Close()
+		err = ctfArchive.Walk(func(ca *ctf.ComponentArchive) error { return nil })
+		Expect(errors.Is(err, ctf.UnsafeArchiveError)).To(BeTrue())
+	})
+
+})
+
+// newTar creates a tar with the given entries.
+// Regular files contain "data".
+func newTar(headers ...*tar.Header) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, header := range headers {
+		Expect(tw.WriteHeader(header)).To(Succeed())
+		if header.Typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte("data"))
+			Expect(err).ToNot(HaveOccurred())
+		}
+	}
+	Expect(tw.Close()).To(Succeed())
+	return buf.Bytes()
+}
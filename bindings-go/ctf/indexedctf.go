@@ -0,0 +1,780 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/mandelsoft/vfs/pkg/memoryfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	"github.com/opencontainers/go-digest"
+
+	v2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/codec"
+)
+
+// IndexedCTF is a ctf archive that is read without extracting it.
+// On creation only the offsets of the component archives and their files within the ctf tar are indexed,
+// component descriptors and blobs are then read by seeking within the original file.
+// Blobs of compressed component archives cannot be indexed and are read by decompressing the component archive up to the blob.
+//
+// The user should call "Close" to release the file and to remove all temporary files.
+type IndexedCTF struct {
+	fs      vfs.FileSystem
+	ctfPath string
+	file    vfs.File
+	// end is the offset of the end of the last entry of the ctf tar.
+	end      int64
+	entries  []indexedEntry
+	archives []*indexedArchive
+	index    map[componentKey]*indexedArchive
+	// sharedBlobs maps the names of all blobs in the shared blob directory to their location.
+	sharedBlobs map[string]indexedFile
+
+	tempDir string
+	// tempFiles is the number of temporary files that have been created in the temporary directory.
+	tempFiles int
+	added     []pendingArchive
+	// extractOpts are the options that are used to extract component archives.
+	extractOpts []ExtractOption
+}
+
+// indexedEntry describes an entry of the ctf tar.
+type indexedEntry struct {
+	header *tar.Header
+	// offset is the offset of the entry's data within the ctf tar.
+	offset int64
+}
+
+// indexedArchive describes a component archive within the ctf tar.
+// The archive is either a tar or gzipped tar file or a directory of filesystem archive.
+type indexedArchive struct {
+	// path is the clean absolute path of the archive within the ctf.
+	path string
+	// entry is the tar entry of archive files.
+	entry       indexedEntry
+	isDir       bool
+	compression Compression
+	cd          *v2.ComponentDescriptor
+	// files maps the clean absolute paths of all regular files in an uncompressed archive to their location.
+	files map[string]indexedFile
+}
+
+// indexedFile describes the location of a file within the ctf tar.
+type indexedFile struct {
+	offset int64
+	size   int64
+}
+
+// pendingArchive is a component archive that is added to the ctf with the next write.
+type pendingArchive struct {
+	name string
+	path string
+	key  componentKey
+}
+
+var _ ComponentResolver = &IndexedCTF{}
+
+// NewIndexedCTF opens a ctf archive and indexes its component archives.
+// The extract options limit the content of component archives that are read into memory.
+func NewIndexedCTF(fs vfs.FileSystem, ctfPath string, opts ...ExtractOption) (*IndexedCTF, error) {
+	ctf := &IndexedCTF{
+		fs:          fs,
+		ctfPath:     ctfPath,
+		extractOpts: opts,
+	}
+	if err := ctf.buildIndex(); err != nil {
+		return nil, fmt.Errorf("unable to index ctf: %w", err)
+	}
+	return ctf, nil
+}
+
+// buildIndex (re)opens the ctf file and indexes all its component archives.
+func (ctf *IndexedCTF) buildIndex() error {
+	file, err := ctf.fs.Open(ctf.ctfPath)
+	if err != nil {
+		return err
+	}
+	ctf.file = file
+	ctf.end = 0
+	ctf.entries = make([]indexedEntry, 0)
+	ctf.archives = make([]*indexedArchive, 0)
+	ctf.index = map[componentKey]*indexedArchive{}
+	ctf.sharedBlobs = map[string]indexedFile{}
+
+	// the tar reader reads exactly up to the data of the current entry,
+	// so the current position of the file is the offset of the entry's data.
+	archiveDirs := map[string]bool{}
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("unable to get offset of %q: %w", header.Name, err)
+		}
+		ctf.end = offset + blockAlign(header.Size)
+		ctf.entries = append(ctf.entries, indexedEntry{
+			header: header,
+			offset: offset,
+		})
+		name := cleanTarPath(header.Name)
+		if header.Typeflag == tar.TypeReg && path.Base(name) == ComponentDescriptorFileName && path.Dir(name) != "/" {
+			archiveDirs[path.Dir(name)] = true
+		}
+	}
+
+	dirArchives := map[string]*indexedArchive{}
+	for _, entry := range ctf.entries {
+		if entry.header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := cleanTarPath(entry.header.Name)
+		if path.Dir(name) == "/"+BlobsDirectoryName {
+			ctf.sharedBlobs[path.Base(name)] = indexedFile{
+				offset: entry.offset,
+				size:   entry.header.Size,
+			}
+			continue
+		}
+		if dir, ok := findArchiveDir(name, archiveDirs); ok {
+			archive, ok := dirArchives[dir]
+			if !ok {
+				archive = &indexedArchive{
+					path:  dir,
+					isDir: true,
+					files: map[string]indexedFile{},
+				}
+				dirArchives[dir] = archive
+				ctf.archives = append(ctf.archives, archive)
+			}
+			archive.files[strings.TrimPrefix(name, dir)] = indexedFile{
+				offset: entry.offset,
+				size:   entry.header.Size,
+			}
+			continue
+		}
+
+		archive, err := indexComponentArchive(file, entry.offset, entry.header.Size)
+		if err != nil {
+			return fmt.Errorf("unable to index component archive %q: %w", entry.header.Name, err)
+		}
+		archive.path = name
+		archive.entry = entry
+		ctf.archives = append(ctf.archives, archive)
+	}
+
+	for _, archive := range ctf.archives {
+		if archive.isDir {
+			cdFile := archive.files[cleanTarPath(ComponentDescriptorFileName)]
+			cd, err := decodeComponentDescriptor(io.NewSectionReader(file, cdFile.offset, cdFile.size))
+			if err != nil {
+				return fmt.Errorf("unable to index component archive %q: %w", archive.path, err)
+			}
+			archive.cd = cd
+		}
+		key := componentKey{
+			Name:    archive.cd.GetName(),
+			Version: archive.cd.GetVersion(),
+		}
+		if existing, ok := ctf.index[key]; ok {
+			return fmt.Errorf("%w: component %q in version %q is contained in %q and %q", DuplicateComponentError, key.Name, key.Version, existing.path, archive.path)
+		}
+		ctf.index[key] = archive
+	}
+	return nil
+}
+
+// findArchiveDir returns the innermost archive directory that contains the given path.
+func findArchiveDir(name string, archiveDirs map[string]bool) (string, bool) {
+	for dir := path.Dir(name); dir != "/"; dir = path.Dir(dir) {
+		if archiveDirs[dir] {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// indexComponentArchive parses the component descriptor of a component archive
+// and indexes the files of the archive if it is not compressed.
+// The archive is expected at the given offset of the reader.
+func indexComponentArchive(ra io.ReaderAt, base, size int64) (*indexedArchive, error) {
+	r := io.NewSectionReader(ra, base, size)
+	magic := make([]byte, maxMagicLength)
+	n, err := r.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	archive := &indexedArchive{
+		compression: DetectCompression(magic[:n]),
+	}
+	if archive.compression != CompressionNone {
+		reader, _, err := openCompressedFile(r, archive.compression, ComponentDescriptorFileName)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		cd, err := decodeComponentDescriptor(reader)
+		if err != nil {
+			return nil, err
+		}
+		archive.cd = cd
+		return archive, nil
+	}
+
+	archive.files = map[string]indexedFile{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		archive.files[cleanTarPath(header.Name)] = indexedFile{
+			offset: base + offset,
+			size:   header.Size,
+		}
+		if cleanTarPath(header.Name) == cleanTarPath(ComponentDescriptorFileName) {
+			cd, err := decodeComponentDescriptor(tr)
+			if err != nil {
+				return nil, err
+			}
+			archive.cd = cd
+		}
+	}
+	if archive.cd == nil {
+		return nil, fmt.Errorf("no %s found", ComponentDescriptorFileName)
+	}
+	return archive, nil
+}
+
+// openCompressedFile returns a reader for the file at the given path of a compressed tar.
+// The returned reader has to be closed to release the decompressor.
+func openCompressedFile(r *io.SectionReader, compression Compression, filepath string) (io.ReadCloser, int64, error) {
+	decompressor, err := newDecompressor(io.NewSectionReader(r, 0, r.Size()), compression)
+	if err != nil {
+		return nil, 0, err
+	}
+	tr := tar.NewReader(decompressor)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			_ = decompressor.Close()
+			if err == io.EOF {
+				return nil, 0, fmt.Errorf("no %s found", filepath)
+			}
+			return nil, 0, err
+		}
+		if header.Typeflag == tar.TypeReg && cleanTarPath(header.Name) == cleanTarPath(filepath) {
+			return struct {
+				io.Reader
+				io.Closer
+			}{tr, decompressor}, header.Size, nil
+		}
+	}
+}
+
+func decodeComponentDescriptor(r io.Reader) (*v2.ComponentDescriptor, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", ComponentDescriptorFileName, err)
+	}
+	cd := &v2.ComponentDescriptor{}
+	if err := codec.Decode(data, cd); err != nil {
+		return nil, fmt.Errorf("unable to parse component descriptor read from %s: %w", ComponentDescriptorFileName, err)
+	}
+	return cd, nil
+}
+
+// cleanTarPath returns the clean absolute path of a tar entry name.
+func cleanTarPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+// blockAlign returns the size rounded up to the tar block size.
+func blockAlign(size int64) int64 {
+	const blockSize = 512
+	return (size + blockSize - 1) / blockSize * blockSize
+}
+
+// section returns a reader for the data of a tar entry.
+func (ctf *IndexedCTF) section(entry indexedEntry) *io.SectionReader {
+	return io.NewSectionReader(ctf.file, entry.offset, entry.header.Size)
+}
+
+// openFile returns a reader for the file at the given path of a component archive.
+// The returned reader has to be closed.
+func (ctf *IndexedCTF) openFile(archive *indexedArchive, filepath string) (io.ReadCloser, int64, error) {
+	if archive.compression != CompressionNone {
+		return openCompressedFile(ctf.section(archive.entry), archive.compression, filepath)
+	}
+	file, ok := archive.files[cleanTarPath(filepath)]
+	if !ok {
+		return nil, 0, fmt.Errorf("no %s found", filepath)
+	}
+	return io.NopCloser(io.NewSectionReader(ctf.file, file.offset, file.size)), file.size, nil
+}
+
+// openBlob returns a reader for the blob with the given name of a component archive.
+// Blobs that are not contained in the archive are read from the shared blob directory.
+// The returned reader has to be closed.
+func (ctf *IndexedCTF) openBlob(archive *indexedArchive, name string) (io.ReadCloser, int64, error) {
+	reader, size, err := ctf.openFile(archive, BlobPath(name))
+	if err != nil {
+		shared, ok := ctf.sharedBlobs[name]
+		if !ok {
+			return nil, 0, err
+		}
+		return io.NopCloser(io.NewSectionReader(ctf.file, shared.offset, shared.size)), shared.size, nil
+	}
+	return reader, size, nil
+}
+
+// openSharedBlob opens the blob with the given name from the shared blob directory of the ctf.
+func (ctf *IndexedCTF) openSharedBlob(name string) (io.ReadCloser, int64, error) {
+	shared, ok := ctf.sharedBlobs[name]
+	if !ok {
+		return nil, 0, nil
+	}
+	return io.NopCloser(io.NewSectionReader(ctf.file, shared.offset, shared.size)), shared.size, nil
+}
+
+func (ctf *IndexedCTF) Resolve(ctx context.Context, repoCtx v2.Repository, name, version string) (*v2.ComponentDescriptor, error) {
+	cd, _, err := ctf.ResolveWithBlobResolver(ctx, repoCtx, name, version)
+	return cd, err
+}
+
+// ResolveWithBlobResolver returns the indexed component descriptor and a blob resolver
+// that reads the blobs of its component archive from the ctf file.
+// The ctf itself is the repository, so the repository context is ignored.
+func (ctf *IndexedCTF) ResolveWithBlobResolver(_ context.Context, _ v2.Repository, name, version string) (*v2.ComponentDescriptor, BlobResolver, error) {
+	archive, ok := ctf.index[componentKey{Name: name, Version: version}]
+	if !ok {
+		return nil, nil, NotFoundError
+	}
+	return archive.cd.DeepCopy(), &indexedBlobResolver{
+		ctf:     ctf,
+		archive: archive,
+	}, nil
+}
+
+// ComponentArchive reads the component archive of the given component into memory, e.g. to modify it.
+// Blobs that are only contained in the shared blob directory are read from the ctf file
+// when they are resolved or the component archive is written.
+func (ctf *IndexedCTF) ComponentArchive(name, version string) (*ComponentArchive, error) {
+	archive, ok := ctf.index[componentKey{Name: name, Version: version}]
+	if !ok {
+		return nil, NotFoundError
+	}
+	ca, err := ctf.readComponentArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	return ca.withSharedBlobs(ctf.openSharedBlob), nil
+}
+
+// readComponentArchive reads the indexed component archive into memory.
+func (ctf *IndexedCTF) readComponentArchive(archive *indexedArchive) (*ComponentArchive, error) {
+	if archive.isDir {
+		fs := memoryfs.New()
+		for name, file := range archive.files {
+			if err := fs.MkdirAll(path.Dir(name), os.ModePerm); err != nil {
+				return nil, err
+			}
+			data, err := io.ReadAll(io.NewSectionReader(ctf.file, file.offset, file.size))
+			if err != nil {
+				return nil, fmt.Errorf("unable to read %q of component archive %q: %w", name, archive.path, err)
+			}
+			if err := vfs.WriteFile(fs, name, data, os.ModePerm); err != nil {
+				return nil, err
+			}
+		}
+		return NewComponentArchiveFromFilesystem(fs)
+	}
+
+	reader, err := newDecompressor(ctf.section(archive.entry), archive.compression)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read component archive %q: %w", archive.path, err)
+	}
+	defer reader.Close()
+	return NewComponentArchiveFromTarReader(reader, ctf.extractOpts...)
+}
+
+// AddComponentArchive adds or updates a component archive in the ctf archive.
+func (ctf *IndexedCTF) AddComponentArchive(ca *ComponentArchive, format ArchiveFormat, opts ...WriteOption) error {
+	filename, err := ca.Digest()
+	if err != nil {
+		return err
+	}
+	return ctf.AddComponentArchiveWithName(filename, ca, format, opts...)
+}
+
+// AddComponentArchiveWithName adds or updates a component archive in the ctf archive.
+// The archive is added to the ctf with the given name.
+// An archive with the same name or of the same component version is replaced.
+// The archive is serialized to a temporary file and only added to the ctf file with the next "Write".
+func (ctf *IndexedCTF) AddComponentArchiveWithName(filename string, ca *ComponentArchive, format ArchiveFormat, opts ...WriteOption) error {
+	if len(ctf.tempDir) == 0 {
+		tempDir, err := vfs.TempDir(ctf.fs, "", "ctf-")
+		if err != nil {
+			return err
+		}
+		ctf.tempDir = tempDir
+	}
+	tempPath := vfs.Join(ctf.fs, ctf.tempDir, fmt.Sprintf("%d", ctf.tempFiles))
+	ctf.tempFiles++
+	if err := writeComponentArchive(ctf.fs, tempPath, ca, format, opts...); err != nil {
+		return fmt.Errorf("unable to write component archive to %q: %w", filename, err)
+	}
+
+	key := componentKey{
+		Name:    ca.ComponentDescriptor.GetName(),
+		Version: ca.ComponentDescriptor.GetVersion(),
+	}
+	added := make([]pendingArchive, 0, len(ctf.added)+1)
+	for _, pending := range ctf.added {
+		if pending.name != filename && pending.key != key {
+			added = append(added, pending)
+			continue
+		}
+		if err := ctf.fs.RemoveAll(pending.path); err != nil {
+			return fmt.Errorf("unable to remove temporary file %q: %w", pending.path, err)
+		}
+	}
+	ctf.added = append(added, pendingArchive{
+		name: filename,
+		path: tempPath,
+		key:  key,
+	})
+	return nil
+}
+
+// Write writes the added component archives to the ctf file and reindexes the ctf.
+// New component archives are appended to the ctf file,
+// the file is only rewritten if existing component archives are replaced.
+// An existing archive is replaced by an added archive with the same name or of the same component version.
+// Shared blobs that are no longer referenced are removed when the file is rewritten.
+// A DuplicateComponentError is returned before anything is written if a component would be contained multiple times.
+// The write options only apply to the entries of the added archives.
+func (ctf *IndexedCTF) Write(opts ...WriteOption) error {
+	options := (&WriteOptions{}).ApplyOptions(opts)
+	if len(ctf.added) == 0 {
+		return nil
+	}
+	replaced := map[string]bool{}
+	for _, pending := range ctf.added {
+		replaced[cleanTarPath(pending.name)] = true
+		if existing, ok := ctf.index[pending.key]; ok {
+			replaced[existing.path] = true
+		}
+	}
+	if err := ctf.checkDuplicates(replaced); err != nil {
+		return err
+	}
+	rewrite := false
+	for _, entry := range ctf.entries {
+		if isReplaced(entry.header.Name, replaced) {
+			rewrite = true
+			break
+		}
+	}
+
+	var err error
+	if rewrite {
+		err = ctf.rewrite(replaced, options)
+	} else {
+		err = ctf.append(options)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, pending := range ctf.added {
+		if err := ctf.fs.RemoveAll(pending.path); err != nil {
+			return fmt.Errorf("unable to remove temporary file %q: %w", pending.path, err)
+		}
+	}
+	ctf.added = nil
+	if err := ctf.file.Close(); err != nil {
+		return err
+	}
+	if err := ctf.buildIndex(); err != nil {
+		return fmt.Errorf("unable to index ctf: %w", err)
+	}
+	return nil
+}
+
+// checkDuplicates returns a DuplicateComponentError if a component would be contained multiple times in the ctf
+// after the replaced archives have been replaced by the added archives.
+func (ctf *IndexedCTF) checkDuplicates(replaced map[string]bool) error {
+	paths := map[componentKey]string{}
+	for _, archive := range ctf.archives {
+		if isReplaced(archive.path, replaced) {
+			continue
+		}
+		paths[componentKey{Name: archive.cd.GetName(), Version: archive.cd.GetVersion()}] = archive.path
+	}
+	for _, pending := range ctf.added {
+		if existing, ok := paths[pending.key]; ok {
+			return fmt.Errorf("%w: component %q in version %q is contained in %q and %q", DuplicateComponentError, pending.key.Name, pending.key.Version, existing, cleanTarPath(pending.name))
+		}
+		paths[pending.key] = cleanTarPath(pending.name)
+	}
+	return nil
+}
+
+// append appends the added component archives to the end of the ctf file.
+func (ctf *IndexedCTF) append(options *WriteOptions) error {
+	file, err := ctf.fs.OpenFile(ctf.ctfPath, os.O_RDWR, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Seek(ctf.end, io.SeekStart); err != nil {
+		return fmt.Errorf("unable to seek to the end of the ctf: %w", err)
+	}
+	cw := &countingWriter{writer: file}
+	tw := tar.NewWriter(cw)
+	if err := ctf.writeAdded(tw, options); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	// remove the remaining padding of the previous end of the tar.
+	if err := file.Truncate(ctf.end + cw.size); err != nil {
+		return fmt.Errorf("unable to truncate ctf: %w", err)
+	}
+	return file.Close()
+}
+
+// isReplaced returns whether the tar entry name is or is part of a replaced component archive.
+func isReplaced(name string, replaced map[string]bool) bool {
+	for name = cleanTarPath(name); name != "/"; name = path.Dir(name) {
+		if replaced[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// rewrite writes a new ctf file that contains all unchanged and all added component archives
+// and replaces the original file.
+// Unchanged entries are copied as they are, shared blobs that are no longer referenced are dropped.
+func (ctf *IndexedCTF) rewrite(replaced map[string]bool, options *WriteOptions) error {
+	file, err := vfs.TempFile(ctf.fs, vfs.Dir(ctf.fs, ctf.ctfPath), ".ctf-")
+	if err != nil {
+		return err
+	}
+	tempPath := file.Name()
+	defer func() {
+		_ = file.Close()
+		_ = ctf.fs.Remove(tempPath)
+	}()
+
+	referenced, err := ctf.referencedSharedBlobs(replaced)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(file)
+	for _, entry := range ctf.entries {
+		if isReplaced(entry.header.Name, replaced) {
+			continue
+		}
+		if name := cleanTarPath(entry.header.Name); path.Dir(name) == "/"+BlobsDirectoryName && !referenced[path.Base(name)] {
+			// shared blobs are only referenced by the component archives that are not replaced.
+			continue
+		}
+		if err := tw.WriteHeader(entry.header); err != nil {
+			return fmt.Errorf("unable to write header for %q: %w", entry.header.Name, err)
+		}
+		if _, err := io.Copy(tw, ctf.section(entry)); err != nil {
+			return fmt.Errorf("unable to write %q: %w", entry.header.Name, err)
+		}
+	}
+	if err := ctf.writeAdded(tw, options); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := ctf.fs.Rename(tempPath, ctf.ctfPath); err != nil {
+		// not all filesystems are able to replace an existing file.
+		if removeErr := ctf.fs.Remove(ctf.ctfPath); removeErr != nil {
+			return fmt.Errorf("unable to replace ctf %q: %w", ctf.ctfPath, err)
+		}
+		if err := ctf.fs.Rename(tempPath, ctf.ctfPath); err != nil {
+			return fmt.Errorf("unable to replace ctf %q: %w", ctf.ctfPath, err)
+		}
+	}
+	return nil
+}
+
+// referencedSharedBlobs returns the names of all local blobs
+// that are referenced by the component archives that are not replaced.
+// Added component archives contain all their blobs, so they do not reference shared blobs.
+func (ctf *IndexedCTF) referencedSharedBlobs(replaced map[string]bool) (map[string]bool, error) {
+	referenced := map[string]bool{}
+	for _, archive := range ctf.archives {
+		if isReplaced(archive.path, replaced) {
+			continue
+		}
+		names, err := localBlobNames(archive.cd)
+		if err != nil {
+			return nil, err
+		}
+		for name := range names {
+			referenced[name] = true
+		}
+	}
+	return referenced, nil
+}
+
+// writeAdded writes all added component archives to the tar writer.
+// Filesystem archives are written as directory with all its files.
+func (ctf *IndexedCTF) writeAdded(tw *tar.Writer, options *WriteOptions) error {
+	for _, pending := range ctf.added {
+		err := vfs.Walk(ctf.fs, pending.path, func(filepath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := strings.TrimPrefix(pending.name, "/") + strings.TrimPrefix(filepath, pending.path)
+			header := &tar.Header{
+				Name:    name,
+				Mode:    0644,
+				ModTime: options.modTime(),
+			}
+			if info.IsDir() {
+				header.Typeflag = tar.TypeDir
+				header.Mode = 0755
+			} else {
+				header.Size = info.Size()
+			}
+			options.normalizeHeader(header)
+			if info.IsDir() {
+				return tw.WriteHeader(header)
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				return fmt.Errorf("unable to write header for %q: %w", name, err)
+			}
+			file, err := ctf.fs.Open(filepath)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			if _, err := io.Copy(tw, file); err != nil {
+				return fmt.Errorf("unable to write %q: %w", name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("unable to write component archive %q: %w", pending.name, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the ctf file and deletes all temporary files.
+// Added component archives that have not been written are discarded.
+func (ctf *IndexedCTF) Close() error {
+	if len(ctf.tempDir) != 0 {
+		if err := ctf.fs.RemoveAll(ctf.tempDir); err != nil {
+			return err
+		}
+	}
+	return ctf.file.Close()
+}
+
+// countingWriter is a writer that counts the written bytes.
+type countingWriter struct {
+	writer io.Writer
+	size   int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// indexedBlobResolver implements the BlobResolver interface for
+// "LocalFilesystemBlob" access types of a component archive of an indexed ctf.
+type indexedBlobResolver struct {
+	ctf     *IndexedCTF
+	archive *indexedArchive
+}
+
+var _ TypedBlobResolver = &indexedBlobResolver{}
+var _ SourceBlobResolver = &indexedBlobResolver{}
+
+func (r *indexedBlobResolver) CanResolve(res v2.Resource) bool {
+	return res.Access != nil && res.Access.GetType() == v2.LocalFilesystemBlobType
+}
+
+func (r *indexedBlobResolver) Info(ctx context.Context, res v2.Resource) (*BlobInfo, error) {
+	return r.Resolve(ctx, res, io.Discard)
+}
+
+func (r *indexedBlobResolver) InfoSource(ctx context.Context, src v2.Source) (*BlobInfo, error) {
+	return r.Info(ctx, sourceResource(src))
+}
+
+func (r *indexedBlobResolver) ResolveSource(ctx context.Context, src v2.Source, writer io.Writer) (*BlobInfo, error) {
+	return r.Resolve(ctx, sourceResource(src), writer)
+}
+
+func (r *indexedBlobResolver) Resolve(_ context.Context, res v2.Resource, writer io.Writer) (*BlobInfo, error) {
+	if res.Access == nil || res.Access.GetType() != v2.LocalFilesystemBlobType {
+		return nil, UnsupportedResolveType
+	}
+	localFSAccess := &v2.LocalFilesystemBlobAccess{}
+	if err := res.Access.DecodeInto(localFSAccess); err != nil {
+		return nil, fmt.Errorf("unable to decode access to type '%s': %w", res.Access.GetType(), err)
+	}
+	mediaType := res.GetType()
+	if len(localFSAccess.MediaType) != 0 {
+		mediaType = localFSAccess.MediaType
+	}
+
+	blobpath := BlobPath(localFSAccess.Filename)
+	reader, size, err := r.ctf.openBlob(r.archive, localFSAccess.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open blob from %s: %w", blobpath, err)
+	}
+	defer reader.Close()
+	digester := digest.Canonical.Digester()
+	if _, err := io.Copy(io.MultiWriter(writer, digester.Hash()), reader); err != nil {
+		return nil, fmt.Errorf("unable to read blob %s: %w", blobpath, err)
+	}
+	return &BlobInfo{
+		MediaType: mediaType,
+		Digest:    digester.Digest().String(),
+		Size:      size,
+	}, nil
+}
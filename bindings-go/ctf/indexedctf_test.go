@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf_test
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/mandelsoft/vfs/pkg/memoryfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+)
+
+var _ = Describe("IndexedCTF", func() {
+
+	var (
+		ctx context.Context
+		fs  vfs.FileSystem
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		fs = memoryfs.New()
+		ctfArchive := newTestCTF(fs, "/ctf.tar")
+		a := newTestComponentArchive("example.com/a", "0.0.0")
+		addTestBlob(a, "res", []byte("blob a"))
+		b := newTestComponentArchive("example.com/b", "0.0.0")
+		addTestBlob(b, "res", []byte("blob b"))
+		Expect(ctfArchive.AddComponentArchiveWithName("a.tar", a, ctf.ArchiveFormatTar)).To(Succeed())
+		Expect(ctfArchive.AddComponentArchiveWithName("b.tgz", b, ctf.ArchiveFormatTarGzip)).To(Succeed())
+		Expect(ctfArchive.Write()).To(Succeed())
+		Expect(ctfArchive.Close()).To(Succeed())
+	})
+
+	It("should resolve component descriptors and blobs of uncompressed and compressed archives", func() {
+		indexed, err := ctf.NewIndexedCTF(fs, "/ctf.tar")
+		Expect(err).ToNot(HaveOccurred())
+		defer indexed.Close()
+
+		for name, data := range map[string]string{"example.com/a": "blob a", "example.com/b": "blob b"} {
+			cd, blobResolver, err := indexed.ResolveWithBlobResolver(ctx, nil, name, "0.0.0")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cd.Name).To(Equal(name))
+
+			var blob bytes.Buffer
+			info, err := blobResolver.Resolve(ctx, cd.Resources[0], &blob)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(blob.String()).To(Equal(data))
+			Expect(info.Digest).To(Equal(digest.FromString(data).String()))
+			Expect(info.Size).To(Equal(int64(len(data))))
+		}
+
+		_, err = indexed.Resolve(ctx, nil, "example.com/a", "0.0.1")
+		Expect(err).To(Equal(ctf.NotFoundError))
+	})
+
+	It("should append added component archives without rewriting the existing archives", func() {
+		original, err := vfs.ReadFile(fs, "/ctf.tar")
+		Expect(err).ToNot(HaveOccurred())
+
+		indexed, err := ctf.NewIndexedCTF(fs, "/ctf.tar")
+		Expect(err).ToNot(HaveOccurred())
+		defer indexed.Close()
+		c := newTestComponentArchive("example.com/c", "0.0.0")
+		addTestBlob(c, "res", []byte("blob c"))
+		Expect(indexed.AddComponentArchiveWithName("c.tar", c, ctf.ArchiveFormatTar)).To(Succeed())
+		Expect(indexed.Write()).To(Succeed())
+
+		cd, err := indexed.Resolve(ctx, nil, "example.com/c", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cd.Name).To(Equal("example.com/c"))
+
+		// the existing entries are kept as they are, only the trailer of the tar is overwritten.
+		updated, err := vfs.ReadFile(fs, "/ctf.tar")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(updated)).To(BeNumerically(">", len(original)))
+		Expect(updated[:len(original)-1024]).To(Equal(original[:len(original)-1024]))
+
+		reopened, err := ctf.NewIndexedCTF(fs, "/ctf.tar")
+		Expect(err).ToNot(HaveOccurred())
+		defer reopened.Close()
+		for _, name := range []string{"example.com/a", "example.com/b", "example.com/c"} {
+			_, err := reopened.Resolve(ctx, nil, name, "0.0.0")
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+
+	It("should replace an existing component archive", func() {
+		indexed, err := ctf.NewIndexedCTF(fs, "/ctf.tar")
+		Expect(err).ToNot(HaveOccurred())
+		defer indexed.Close()
+
+		a, err := indexed.ComponentArchive("example.com/a", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		addTestBlob(a, "res", []byte("updated blob a"))
+		Expect(indexed.AddComponentArchiveWithName("a.tar", a, ctf.ArchiveFormatTar)).To(Succeed())
+		Expect(indexed.Write()).To(Succeed())
+
+		cd, blobResolver, err := indexed.ResolveWithBlobResolver(ctx, nil, "example.com/a", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cd.Resources).To(HaveLen(1))
+		var blob bytes.Buffer
+		_, err = blobResolver.Resolve(ctx, cd.Resources[0], &blob)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blob.String()).To(Equal("updated blob a"))
+
+		_, err = indexed.Resolve(ctx, nil, "example.com/b", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should replace a modified component archive that is added with a new name", func() {
+		indexed, err := ctf.NewIndexedCTF(fs, "/ctf.tar")
+		Expect(err).ToNot(HaveOccurred())
+		defer indexed.Close()
+
+		a, err := indexed.ComponentArchive("example.com/a", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		addTestBlob(a, "res", []byte("updated blob a"))
+		Expect(indexed.AddComponentArchive(a, ctf.ArchiveFormatTar)).To(Succeed())
+		a.ComponentDescriptor.Labels = cdv2.Labels{{Name: "updated", Value: []byte("true")}}
+		Expect(indexed.AddComponentArchive(a, ctf.ArchiveFormatTar)).To(Succeed())
+		Expect(indexed.Write()).To(Succeed())
+
+		reopened, err := ctf.NewIndexedCTF(fs, "/ctf.tar")
+		Expect(err).ToNot(HaveOccurred())
+		defer reopened.Close()
+		cd, blobResolver, err := reopened.ResolveWithBlobResolver(ctx, nil, "example.com/a", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cd.Labels).To(HaveLen(1))
+		var blob bytes.Buffer
+		_, err = blobResolver.Resolve(ctx, cd.Resources[0], &blob)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blob.String()).To(Equal("updated blob a"))
+		_, err = reopened.Resolve(ctx, nil, "example.com/b", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+})
+
+// addTestBlob adds a resource with the given blob to a component archive.
+func addTestBlob(ca *ctf.ComponentArchive, name string, data []byte) {
+	res := cdv2.Resource{
+		IdentityObjectMeta: cdv2.IdentityObjectMeta{
+			Name:    name,
+			Version: "0.0.0",
+			Type:    "blob",
+		},
+		Relation: cdv2.LocalRelation,
+	}
+	Expect(ca.AddResource(&res, ctf.BlobInfo{
+		MediaType: "txt",
+		Digest:    digest.FromBytes(data).String(),
+		Size:      int64(len(data)),
+	}, bytes.NewBuffer(data))).To(Succeed())
+}
@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MergeConflictError is returned if a merged ctf contains a component
+// with a different component descriptor than the target.
+var MergeConflictError = errors.New("MergeConflict")
+
+// MergePolicy defines how conflicting component archives are handled on merge.
+type MergePolicy string
+
+const (
+	// MergePolicyFail aborts the merge with a MergeConflictError on conflicts.
+	MergePolicyFail MergePolicy = "fail"
+	// MergePolicyOverwrite replaces conflicting component archives with the incoming archive.
+	MergePolicyOverwrite MergePolicy = "overwrite"
+)
+
+// ApplyMergeOption applies the configured merge policy.
+func (p MergePolicy) ApplyMergeOption(options *MergeOptions) {
+	options.Policy = p
+}
+
+// MergeOptions defines the options for merging ctfs.
+type MergeOptions struct {
+	// Policy defines how conflicts are handled, defaults to MergePolicyFail.
+	Policy MergePolicy
+	// WriteOptions are the options that are used to write the merged component archives.
+	WriteOptions []WriteOption
+}
+
+// ApplyOptions applies the given list options on these options,
+// and then returns itself (for convenient chaining).
+func (o *MergeOptions) ApplyOptions(opts []MergeOption) *MergeOptions {
+	for _, opt := range opts {
+		if opt != nil {
+			opt.ApplyMergeOption(o)
+		}
+	}
+	return o
+}
+
+// MergeOption is the interface to specify different merge options.
+type MergeOption interface {
+	ApplyMergeOption(options *MergeOptions)
+}
+
+// MergeWriteOptions defines the write options that are used to write the merged component archives.
+type MergeWriteOptions []WriteOption
+
+// ApplyMergeOption applies the configured write options.
+func (w MergeWriteOptions) ApplyMergeOption(options *MergeOptions) {
+	options.WriteOptions = append(options.WriteOptions, w...)
+}
+
+// MergeReport describes the result of a merge.
+// The paths of all infos are the paths within the merged ctf.
+type MergeReport struct {
+	// Added are the component archives that have been added.
+	Added []ComponentArchiveInfo
+	// Deduplicated are the component archives that have been skipped
+	// as the ctf already contained the same component descriptor.
+	Deduplicated []ComponentArchiveInfo
+	// Replaced are the component archives that replaced an archive with a different component descriptor.
+	Replaced []ComponentArchiveInfo
+}
+
+// mergeAction describes how an incoming component archive is merged.
+type mergeAction int
+
+const (
+	mergeAdd mergeAction = iota
+	mergeDeduplicate
+	mergeReplace
+)
+
+// mergeItem is a component archive of an incoming ctf.
+type mergeItem struct {
+	source *CTF
+	info   ComponentArchiveInfo
+	action mergeAction
+}
+
+// Merge adds all component archives of the given ctfs to the ctf.
+// Components that are already contained with the same component descriptor digest are deduplicated.
+// Components with a different digest are handled according to the merge policy.
+// With the default policy, the ctf is not modified if any conflict is detected.
+// The archives keep their path and format unless the path is already used by another component,
+// then the archive is named by its digest.
+func (ctf *CTF) Merge(sources []*CTF, opts ...MergeOption) (*MergeReport, error) {
+	options := (&MergeOptions{Policy: MergePolicyFail}).ApplyOptions(opts)
+	if options.Policy != MergePolicyFail && options.Policy != MergePolicyOverwrite {
+		return nil, fmt.Errorf("unsupported merge policy %q", options.Policy)
+	}
+
+	list, err := ctf.List()
+	if err != nil {
+		return nil, err
+	}
+	components := map[componentKey]ComponentArchiveInfo{}
+	for _, info := range list {
+		components[componentKey{Name: info.Name, Version: info.Version}] = info
+	}
+
+	// all conflicts are detected before the ctf is modified.
+	items := make([]mergeItem, 0)
+	for i, source := range sources {
+		incoming, err := source.List()
+		if err != nil {
+			return nil, fmt.Errorf("unable to list component archives of ctf %d: %w", i, err)
+		}
+		for _, info := range incoming {
+			key := componentKey{Name: info.Name, Version: info.Version}
+			item := mergeItem{
+				source: source,
+				info:   info,
+				action: mergeAdd,
+			}
+			if existing, ok := components[key]; ok {
+				switch {
+				case existing.Digest == info.Digest:
+					item.action = mergeDeduplicate
+				case options.Policy == MergePolicyOverwrite:
+					item.action = mergeReplace
+				default:
+					return nil, fmt.Errorf("%w: component %q in version %q has digest %s but the incoming archive %q of ctf %d has digest %s",
+						MergeConflictError, key.Name, key.Version, existing.Digest, info.Path, i, info.Digest)
+				}
+			}
+			if item.action != mergeDeduplicate {
+				components[key] = info
+			}
+			items = append(items, item)
+		}
+	}
+
+	report := &MergeReport{
+		Added:        make([]ComponentArchiveInfo, 0),
+		Deduplicated: make([]ComponentArchiveInfo, 0),
+		Replaced:     make([]ComponentArchiveInfo, 0),
+	}
+	// archives is the index of the ctf that is updated as the archives are merged.
+	archives := list
+	for _, item := range items {
+		if item.action == mergeDeduplicate {
+			for _, existing := range archives {
+				if existing.Name == item.info.Name && existing.Version == item.info.Version {
+					report.Deduplicated = append(report.Deduplicated, existing)
+					break
+				}
+			}
+			continue
+		}
+		info, err := ctf.mergeComponentArchive(item, archives, options)
+		if err != nil {
+			return nil, err
+		}
+		merged := make([]ComponentArchiveInfo, 0, len(archives)+1)
+		for _, existing := range archives {
+			if existing.Name != info.Name || existing.Version != info.Version {
+				merged = append(merged, existing)
+			}
+		}
+		archives = append(merged, info)
+		if item.action == mergeReplace {
+			report.Replaced = append(report.Replaced, info)
+		} else {
+			report.Added = append(report.Added, info)
+		}
+	}
+	if len(report.Replaced) != 0 {
+		if err := ctf.pruneSharedBlobs(); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// mergeComponentArchive adds the component archive of a merge item to the ctf
+// and removes other archives of the same component.
+// The archives are the current component archives of the ctf.
+func (ctf *CTF) mergeComponentArchive(item mergeItem, archives []ComponentArchiveInfo, options *MergeOptions) (ComponentArchiveInfo, error) {
+	ca, err := item.source.readComponentArchive(item.info.Path)
+	if err != nil {
+		return ComponentArchiveInfo{}, err
+	}
+	format, err := item.source.archiveFormat(item.info.Path)
+	if err != nil {
+		return ComponentArchiveInfo{}, err
+	}
+
+	path := item.info.Path
+	previous := make([]string, 0)
+	for _, existing := range archives {
+		if existing.Name == item.info.Name && existing.Version == item.info.Version {
+			previous = append(previous, existing.Path)
+			continue
+		}
+		if pathOverlaps(existing.Path, item.info.Path) {
+			path = item.info.Digest
+		}
+	}
+	if err := ctf.replaceWithName(path, ca, format, previous, options.WriteOptions...); err != nil {
+		return ComponentArchiveInfo{}, fmt.Errorf("unable to add component archive %q: %w", item.info.Path, err)
+	}
+	info := item.info
+	info.Path = path
+	return info, nil
+}
+
+// pathOverlaps returns whether one of the paths is the same or a parent of the other path.
+func pathOverlaps(a, b string) bool {
+	a, b = strings.Trim(a, "/"), strings.Trim(b, "/")
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
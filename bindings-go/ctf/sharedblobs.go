@@ -0,0 +1,348 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/mandelsoft/vfs/pkg/memoryfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	"github.com/opencontainers/go-digest"
+)
+
+// BlobLayout describes where the blobs of the component archives of a ctf are stored.
+type BlobLayout string
+
+const (
+	// BlobLayoutArchive is the default layout where every component archive contains all its blobs.
+	BlobLayoutArchive BlobLayout = "archive"
+	// BlobLayoutShared is a layout where all blobs that are named by their digest are stored once
+	// in a shared blob directory at the top level of the ctf.
+	// The component archives only contain the blobs that are not named by their digest.
+	BlobLayoutShared BlobLayout = "shared"
+)
+
+// sharedBlobPath returns the path of a blob in the shared blob directory of a ctf.
+func sharedBlobPath(name string) string {
+	return "/" + BlobPath(name)
+}
+
+// BlobLayout returns the blob layout of the ctf.
+// A ctf uses the shared layout if it contains a top level blob directory.
+func (ctf *CTF) BlobLayout() (BlobLayout, error) {
+	ok, err := vfs.DirExists(ctf.tempFs, "/"+BlobsDirectoryName)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return BlobLayoutShared, nil
+	}
+	return BlobLayoutArchive, nil
+}
+
+// ConvertBlobLayout converts the ctf to the given blob layout.
+// All component archives are rewritten in their current format.
+func (ctf *CTF) ConvertBlobLayout(layout BlobLayout, opts ...WriteOption) error {
+	current, err := ctf.BlobLayout()
+	if err != nil {
+		return err
+	}
+	if current == layout {
+		return nil
+	}
+	if layout != BlobLayoutShared && layout != BlobLayoutArchive {
+		return fmt.Errorf("unsupported blob layout %q", layout)
+	}
+
+	list, err := ctf.List()
+	if err != nil {
+		return err
+	}
+	if layout == BlobLayoutShared {
+		if err := ctf.tempFs.MkdirAll("/"+BlobsDirectoryName, os.ModePerm); err != nil {
+			return fmt.Errorf("unable to create shared blob directory: %w", err)
+		}
+	}
+	for _, info := range list {
+		format, err := ctf.archiveFormat(info.Path)
+		if err != nil {
+			return err
+		}
+		// the archive is read with all its blobs as the shared blob directory still exists.
+		ca, err := ctf.readComponentArchive(info.Path)
+		if err != nil {
+			return err
+		}
+		if err := ctf.addComponentArchiveWithName(info.Path, ca, format, layout, opts...); err != nil {
+			return err
+		}
+	}
+	if layout == BlobLayoutArchive {
+		if err := ctf.tempFs.RemoveAll("/" + BlobsDirectoryName); err != nil {
+			return fmt.Errorf("unable to remove shared blob directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// archiveFormat returns the format of the component archive at the given path.
+func (ctf *CTF) archiveFormat(path string) (ArchiveFormat, error) {
+	isDir, err := vfs.DirExists(ctf.tempFs, path)
+	if err != nil {
+		return "", err
+	}
+	if isDir {
+		return ArchiveFormatFilesystem, nil
+	}
+	file, err := ctf.tempFs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	magic := make([]byte, maxMagicLength)
+	n, err := io.ReadFull(file, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("unable to read %q: %w", path, err)
+	}
+	switch DetectCompression(magic[:n]) {
+	case CompressionGzip:
+		return ArchiveFormatTarGzip, nil
+	case CompressionZstd:
+		return ArchiveFormatTarZstd, nil
+	default:
+		return ArchiveFormatTar, nil
+	}
+}
+
+// shareBlobs moves all blobs of the component archive that are named by their digest to the shared blob directory
+// and returns a copy of the component archive without these blobs.
+// Blobs that the component archive reads from a shared blob directory are added to the shared blob directory of the ctf.
+func (ctf *CTF) shareBlobs(ca *ComponentArchive) (*ComponentArchive, error) {
+	shared := NewComponentArchive(ca.ComponentDescriptor, memoryfs.New())
+	blobs, err := ca.blobs()
+	if err != nil {
+		return nil, err
+	}
+	if err := shared.ensureBlobsPath(); err != nil {
+		return nil, err
+	}
+	for _, blob := range blobs {
+		blobpath := BlobPath(blob.name)
+		if !blob.shared {
+			ok, err := isDigestBlob(ca.fs, blobpath, blob.name)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				if err := vfs.CopyFile(ca.fs, blobpath, shared.fs, blobpath); err != nil {
+					return nil, fmt.Errorf("unable to copy blob %q: %w", blobpath, err)
+				}
+				continue
+			}
+		}
+		exists, err := vfs.FileExists(ctf.tempFs, sharedBlobPath(blob.name))
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			continue
+		}
+		if err := copyBlob(blob, ctf.tempFs, sharedBlobPath(blob.name)); err != nil {
+			return nil, fmt.Errorf("unable to copy blob %q to shared blob directory: %w", blobpath, err)
+		}
+	}
+	return shared, nil
+}
+
+// isDigestBlob returns whether the blob is named by the digest of its content.
+func isDigestBlob(fs vfs.FileSystem, blobpath, name string) (bool, error) {
+	expected, err := digest.Parse(name)
+	if err != nil {
+		return false, nil
+	}
+	file, err := fs.Open(blobpath)
+	if err != nil {
+		return false, fmt.Errorf("unable to open blob %q: %w", blobpath, err)
+	}
+	defer file.Close()
+	actual, err := expected.Algorithm().FromReader(file)
+	if err != nil {
+		return false, fmt.Errorf("unable to compute digest of blob %q: %w", blobpath, err)
+	}
+	return actual == expected, nil
+}
+
+// sharedBlobOpener opens the blob with the given name from a shared blob directory and returns its size.
+// A nil reader is returned if the blob is not contained in the shared blob directory.
+type sharedBlobOpener func(name string) (io.ReadCloser, int64, error)
+
+// openSharedBlob opens the blob with the given name from the shared blob directory of the ctf.
+func (ctf *CTF) openSharedBlob(name string) (io.ReadCloser, int64, error) {
+	info, err := ctf.tempFs.Stat(sharedBlobPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	if info.IsDir() {
+		return nil, 0, nil
+	}
+	file, err := ctf.tempFs.Open(sharedBlobPath(name))
+	if err != nil {
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// pruneSharedBlobs removes all blobs from the shared blob directory
+// that are not referenced by any component archive of the ctf.
+func (ctf *CTF) pruneSharedBlobs() error {
+	layout, err := ctf.BlobLayout()
+	if err != nil {
+		return err
+	}
+	if layout != BlobLayoutShared {
+		return nil
+	}
+	paths, err := ctf.archivePaths("/")
+	if err != nil {
+		return err
+	}
+	referenced := map[string]bool{}
+	for _, path := range paths {
+		cd, err := ctf.readComponentDescriptor(path)
+		if err != nil {
+			return err
+		}
+		names, err := localBlobNames(cd)
+		if err != nil {
+			return err
+		}
+		for name := range names {
+			referenced[name] = true
+		}
+	}
+	infos, err := vfs.ReadDir(ctf.tempFs, "/"+BlobsDirectoryName)
+	if err != nil {
+		return fmt.Errorf("unable to read shared blob directory: %w", err)
+	}
+	for _, info := range infos {
+		if referenced[info.Name()] {
+			continue
+		}
+		if err := ctf.tempFs.RemoveAll(sharedBlobPath(info.Name())); err != nil {
+			return fmt.Errorf("unable to remove shared blob %q: %w", info.Name(), err)
+		}
+	}
+	return nil
+}
+
+// withSharedBlobs configures the component archive to read the referenced blobs
+// that are not contained in the archive from a shared blob directory.
+// The shared blobs are only read when they are resolved or the archive is written.
+func (ca *ComponentArchive) withSharedBlobs(open sharedBlobOpener) *ComponentArchive {
+	ca.sharedBlobs = open
+	if resolver, ok := ca.BlobResolver.(*ComponentArchiveBlobResolver); ok {
+		resolver.sharedBlobs = open
+	}
+	return ca
+}
+
+// archiveBlob describes a blob of a component archive.
+type archiveBlob struct {
+	name string
+	size int64
+	// shared defines whether the blob is read from a shared blob directory.
+	shared bool
+	open   func() (io.ReadCloser, error)
+}
+
+// blobs returns all blobs of the component archive
+// including the referenced blobs that are only contained in a shared blob directory.
+// Directories in the blob directory are ignored.
+func (ca *ComponentArchive) blobs() ([]archiveBlob, error) {
+	infos, err := vfs.ReadDir(ca.fs, BlobsDirectoryName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read blob directory: %w", err)
+	}
+	blobs := make([]archiveBlob, 0, len(infos))
+	existing := map[string]bool{}
+	for _, info := range infos {
+		existing[info.Name()] = true
+		if info.IsDir() {
+			continue
+		}
+		blobpath := BlobPath(info.Name())
+		blobs = append(blobs, archiveBlob{
+			name: info.Name(),
+			size: info.Size(),
+			open: func() (io.ReadCloser, error) {
+				return ca.fs.Open(blobpath)
+			},
+		})
+	}
+	if ca.sharedBlobs == nil {
+		return blobs, nil
+	}
+	referenced, err := localBlobNames(ca.ComponentDescriptor)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(referenced))
+	for name := range referenced {
+		if !existing[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		reader, size, err := ca.sharedBlobs(name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open shared blob %q: %w", name, err)
+		}
+		if reader == nil {
+			continue
+		}
+		if err := reader.Close(); err != nil {
+			return nil, err
+		}
+		name := name
+		blobs = append(blobs, archiveBlob{
+			name:   name,
+			size:   size,
+			shared: true,
+			open: func() (io.ReadCloser, error) {
+				reader, _, err := ca.sharedBlobs(name)
+				if err == nil && reader == nil {
+					err = os.ErrNotExist
+				}
+				return reader, err
+			},
+		})
+	}
+	return blobs, nil
+}
+
+// copyBlob copies the blob to the given path of the filesystem.
+func copyBlob(blob archiveBlob, fs vfs.FileSystem, path string) error {
+	reader, err := blob.open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	file, err := fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, reader); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ctf
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// ReproducibleModTime is the modification time of all entries written in reproducible mode.
+var ReproducibleModTime = time.Unix(0, 0).UTC()
+
+// WriteOptions defines options for writing component archives and ctfs.
+type WriteOptions struct {
+	// Reproducible defines whether the output only depends on the content,
+	// so that the same content always results in the same bytes.
+	Reproducible bool
+}
+
+// ApplyOptions applies the given list options on these options,
+// and then returns itself (for convenient chaining).
+func (o *WriteOptions) ApplyOptions(opts []WriteOption) *WriteOptions {
+	for _, opt := range opts {
+		if opt != nil {
+			opt.ApplyOption(o)
+		}
+	}
+	return o
+}
+
+// WriteOption is the interface to specify different write options.
+type WriteOption interface {
+	ApplyOption(options *WriteOptions)
+}
+
+// Reproducible enables or disables the reproducible mode.
+// In reproducible mode entries are sorted by name and written with a fixed modification time,
+// without owner information and with normalized file modes.
+// Gzip headers do not contain any name or time information.
+type Reproducible bool
+
+// ApplyOption applies the configured reproducible mode.
+func (r Reproducible) ApplyOption(options *WriteOptions) {
+	options.Reproducible = bool(r)
+}
+
+// modTime returns the modification time of new tar entries.
+func (o *WriteOptions) modTime() time.Time {
+	if o.Reproducible {
+		return ReproducibleModTime
+	}
+	return time.Now()
+}
+
+// normalizeHeader removes all information from a tar header
+// that do not describe the content of the entry if the reproducible mode is enabled.
+func (o *WriteOptions) normalizeHeader(header *tar.Header) {
+	if !o.Reproducible {
+		return
+	}
+	header.ModTime = ReproducibleModTime
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Uid = 0
+	header.Gid = 0
+	header.Uname = ""
+	header.Gname = ""
+	header.PAXRecords = nil
+	header.Format = tar.FormatUnknown
+	switch {
+	case header.Typeflag == tar.TypeDir || header.Mode&0111 != 0:
+		header.Mode = 0755
+	default:
+		header.Mode = 0644
+	}
+}
+
+// newGzipWriter creates a new gzip writer with a stable header.
+func (o *WriteOptions) newGzipWriter(writer io.Writer) *gzip.Writer {
+	gw := gzip.NewWriter(writer)
+	if o.Reproducible {
+		gw.Header = gzip.Header{OS: 255}
+	}
+	return gw
+}
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mandelsoft/vfs/pkg/vfs"
+)
+
+// DockerConfigFileName is the name of the docker config file.
+const DockerConfigFileName = "config.json"
+
+// credentialHelperPrefix is the prefix of all docker credential helper executables.
+const credentialHelperPrefix = "docker-credential-"
+
+// credentialsNotFoundMessage is the message that is returned by credential helpers if no credentials are stored.
+const credentialsNotFoundMessage = "credentials not found in native keychain"
+
+// tokenUsername is the username that is returned by credential helpers if the secret is an identity token.
+const tokenUsername = "<token>"
+
+// DockerConfig describes the parts of a docker config file that define credentials.
+type DockerConfig struct {
+	// Auths maps registry urls to their credentials.
+	Auths map[string]DockerAuthConfig `json:"auths,omitempty"`
+	// CredentialsStore is the name of the credential helper that is used for all registries.
+	CredentialsStore string `json:"credsStore,omitempty"`
+	// CredentialHelpers maps registry hosts to the name of the credential helper for that registry.
+	CredentialHelpers map[string]string `json:"credHelpers,omitempty"`
+}
+
+// DockerAuthConfig describes the credentials of a registry in a docker config file.
+type DockerAuthConfig struct {
+	// Auth is the base64 encoded "username:password".
+	Auth          string `json:"auth,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+	RegistryToken string `json:"registrytoken,omitempty"`
+}
+
+// Credentials returns the credentials defined by the auth config.
+func (a DockerAuthConfig) Credentials() (Credentials, error) {
+	creds := Credentials{
+		Username:      a.Username,
+		Password:      a.Password,
+		IdentityToken: a.IdentityToken,
+		RegistryToken: a.RegistryToken,
+	}
+	if len(a.Auth) != 0 {
+		decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("unable to decode auth: %w", err)
+		}
+		splitAuth := strings.SplitN(string(decoded), ":", 2)
+		if len(splitAuth) != 2 {
+			return Credentials{}, fmt.Errorf("invalid auth: expected username and password separated by a colon")
+		}
+		creds.Username = splitAuth[0]
+		creds.Password = splitAuth[1]
+	}
+	return creds, nil
+}
+
+// DefaultDockerConfigPath returns the path of the docker config file of the current user.
+// The directory defined by the "DOCKER_CONFIG" environment variable is preferred over "$HOME/.docker".
+func DefaultDockerConfigPath() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); len(dir) != 0 {
+		return filepath.Join(dir, DockerConfigFileName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".docker", DockerConfigFileName), nil
+}
+
+// CredentialHelperFunc describes a function that gets the credentials for a server from a docker credential helper.
+// Nil is returned if the helper does not know the server.
+type CredentialHelperFunc func(ctx context.Context, helper, serverURL string) (*Credentials, error)
+
+// DockerConfigKeychain is a keychain that reads credentials from a docker config file.
+// Credential helpers configured in the file are executed as local executables named "docker-credential-<helper>".
+type DockerConfigKeychain struct {
+	config DockerConfig
+	helper CredentialHelperFunc
+}
+
+var _ Keychain = &DockerConfigKeychain{}
+
+// NewDockerConfigKeychain reads the docker config file at the given path.
+func NewDockerConfigKeychain(fs vfs.FileSystem, path string) (*DockerConfigKeychain, error) {
+	data, err := vfs.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read docker config from %q: %w", path, err)
+	}
+	return NewDockerConfigKeychainFromBytes(data)
+}
+
+// NewDockerConfigKeychainFromBytes parses a docker config file.
+func NewDockerConfigKeychainFromBytes(data []byte) (*DockerConfigKeychain, error) {
+	config := DockerConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to decode docker config: %w", err)
+	}
+	return NewDockerConfigKeychainFromConfig(config), nil
+}
+
+// NewDockerConfigKeychainFromConfig creates a new keychain for an already parsed docker config.
+func NewDockerConfigKeychainFromConfig(config DockerConfig) *DockerConfigKeychain {
+	return &DockerConfigKeychain{
+		config: config,
+		helper: ExecCredentialHelper,
+	}
+}
+
+// WithCredentialHelper overwrites the function that is used to call credential helpers.
+func (k *DockerConfigKeychain) WithCredentialHelper(helper CredentialHelperFunc) *DockerConfigKeychain {
+	k.helper = helper
+	return k
+}
+
+// Resolve returns the credentials for the given oci reference.
+// Registry specific credential helpers take precedence over the credentials store
+// which takes precedence over the credentials that are directly defined in the config.
+func (k *DockerConfigKeychain) Resolve(ctx context.Context, ref string) (*Credentials, error) {
+	host := RefHost(ref)
+	if registry, helper, ok := k.credentialHelper(ref); ok {
+		return k.helper(ctx, helper, registry)
+	}
+
+	prefixes := make([]string, 0, len(k.config.Auths))
+	for prefix := range k.config.Auths {
+		prefixes = append(prefixes, prefix)
+	}
+	prefix, ok := MatchPrefix(ref, prefixes)
+
+	if len(k.config.CredentialsStore) != 0 {
+		serverURL := host
+		if ok {
+			serverURL = prefix
+		}
+		creds, err := k.helper(ctx, k.config.CredentialsStore, serverURL)
+		if err != nil {
+			return nil, err
+		}
+		if creds != nil {
+			return creds, nil
+		}
+	}
+
+	if !ok {
+		return nil, nil
+	}
+	creds, err := k.config.Auths[prefix].Credentials()
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials for %q: %w", prefix, err)
+	}
+	return &creds, nil
+}
+
+// credentialHelper returns the registry and the name of the registry specific credential helper for a reference.
+// A registry that is exactly the host of the reference is preferred over a registry that is an alias of the host.
+// If multiple aliases match, the alphabetically first registry is used.
+func (k *DockerConfigKeychain) credentialHelper(ref string) (string, string, bool) {
+	registries := make([]string, 0, len(k.config.CredentialHelpers))
+	for registry := range k.config.CredentialHelpers {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+
+	host := refHost(ref)
+	for _, registry := range registries {
+		if refHost(registry) == host {
+			return registry, k.config.CredentialHelpers[registry], true
+		}
+	}
+	normalizedHost := RefHost(ref)
+	for _, registry := range registries {
+		if RefHost(registry) == normalizedHost {
+			return registry, k.config.CredentialHelpers[registry], true
+		}
+	}
+	return "", "", false
+}
+
+// credentialHelperResponse is the response of a credential helper "get" call.
+type credentialHelperResponse struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// ExecCredentialHelper gets the credentials for a server by executing the docker credential helper
+// "docker-credential-<helper> get" as described in https://github.com/docker/docker-credential-helpers.
+func ExecCredentialHelper(ctx context.Context, helper, serverURL string) (*Credentials, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, credentialHelperPrefix+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String(), credentialsNotFoundMessage) || strings.Contains(stderr.String(), credentialsNotFoundMessage) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to get credentials for %q from credential helper %q: %w: %s", serverURL, helper, err, strings.TrimSpace(stderr.String()))
+	}
+
+	resp := credentialHelperResponse{}
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("unable to decode response of credential helper %q: %w", helper, err)
+	}
+	if resp.Username == tokenUsername {
+		return &Credentials{IdentityToken: resp.Secret}, nil
+	}
+	return &Credentials{
+		Username: resp.Username,
+		Password: resp.Secret,
+	}, nil
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultEnvPrefix is the default prefix of environment variables that define credentials.
+const DefaultEnvPrefix = "OCI_CREDENTIALS"
+
+// environment variable suffixes of the credential fields.
+const (
+	envRegistrySuffix      = "_REGISTRY"
+	envUsernameSuffix      = "_USERNAME"
+	envPasswordSuffix      = "_PASSWORD"
+	envIdentityTokenSuffix = "_IDENTITY_TOKEN"
+	envRegistryTokenSuffix = "_REGISTRY_TOKEN"
+)
+
+// NewEnvKeychain creates a static keychain from environment variables.
+// Credentials are grouped by an arbitrary id and defined by the variables
+// - <prefix>_<id>_REGISTRY: the registry host with an optional path prefix (required)
+// - <prefix>_<id>_USERNAME, <prefix>_<id>_PASSWORD: basic auth credentials
+// - <prefix>_<id>_IDENTITY_TOKEN: an identity token
+// - <prefix>_<id>_REGISTRY_TOKEN: a registry bearer token
+//
+// Every registry can only be defined by one id.
+// The DefaultEnvPrefix is used if no prefix is given and
+// the environment of the current process is used if environ is nil.
+func NewEnvKeychain(prefix string, environ []string) (*StaticKeychain, error) {
+	if len(prefix) == 0 {
+		prefix = DefaultEnvPrefix
+	}
+	if environ == nil {
+		environ = os.Environ()
+	}
+	prefix = prefix + "_"
+
+	registries := map[string]string{}
+	creds := map[string]*Credentials{}
+	get := func(id string) *Credentials {
+		if _, ok := creds[id]; !ok {
+			creds[id] = &Credentials{}
+		}
+		return creds[id]
+	}
+	for _, env := range environ {
+		splitEnv := strings.SplitN(env, "=", 2)
+		if len(splitEnv) != 2 || !strings.HasPrefix(splitEnv[0], prefix) {
+			continue
+		}
+		key, value := strings.TrimPrefix(splitEnv[0], prefix), splitEnv[1]
+		switch {
+		case strings.HasSuffix(key, envRegistryTokenSuffix):
+			get(strings.TrimSuffix(key, envRegistryTokenSuffix)).RegistryToken = value
+		case strings.HasSuffix(key, envIdentityTokenSuffix):
+			get(strings.TrimSuffix(key, envIdentityTokenSuffix)).IdentityToken = value
+		case strings.HasSuffix(key, envRegistrySuffix):
+			registries[strings.TrimSuffix(key, envRegistrySuffix)] = value
+		case strings.HasSuffix(key, envUsernameSuffix):
+			get(strings.TrimSuffix(key, envUsernameSuffix)).Username = value
+		case strings.HasSuffix(key, envPasswordSuffix):
+			get(strings.TrimSuffix(key, envPasswordSuffix)).Password = value
+		}
+	}
+
+	ids := make([]string, 0, len(creds))
+	for id := range creds {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	keychain := NewStaticKeychain(nil)
+	definedBy := map[string]string{}
+	for _, id := range ids {
+		registry, ok := registries[id]
+		if !ok || len(registry) == 0 {
+			return nil, fmt.Errorf("no registry defined for credentials %q: %s%s%s has to be set", id, prefix, id, envRegistrySuffix)
+		}
+		normalized := NormalizeRef(registry)
+		if other, ok := definedBy[normalized]; ok {
+			return nil, fmt.Errorf("registry %q is defined by the credentials %q and %q", registry, other, id)
+		}
+		definedBy[normalized] = id
+		keychain.Add(registry, *creds[id])
+	}
+	return keychain, nil
+}
@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Credentials describes the credentials that are used to authenticate against a oci registry.
+type Credentials struct {
+	// Username is the username for basic authentication.
+	Username string `json:"username,omitempty"`
+	// Password is the password for basic authentication.
+	Password string `json:"password,omitempty"`
+	// IdentityToken is a refresh token that is used to obtain an access token from the registry's token server.
+	IdentityToken string `json:"identitytoken,omitempty"`
+	// RegistryToken is a bearer token that is directly sent to the registry.
+	RegistryToken string `json:"registrytoken,omitempty"`
+}
+
+// AuthorizationHeader returns the value of the http authorization header for the credentials.
+// An empty string is returned if the credentials can only be used to request a token (identity token).
+func (c Credentials) AuthorizationHeader() string {
+	if len(c.RegistryToken) != 0 {
+		return "Bearer " + c.RegistryToken
+	}
+	if len(c.Username) != 0 || len(c.Password) != 0 {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password))
+	}
+	return ""
+}
+
+// credentialsContextKey is the context key of the credentials of a request.
+type credentialsContextKey struct{}
+
+// NewContext returns a new context that carries the given credentials.
+// Clients read the credentials of a request with FromContext.
+func NewContext(ctx context.Context, creds *Credentials) context.Context {
+	return context.WithValue(ctx, credentialsContextKey{}, creds)
+}
+
+// FromContext returns the credentials that are carried by the context.
+// Nil is returned if the context does not carry credentials.
+func FromContext(ctx context.Context) *Credentials {
+	creds, _ := ctx.Value(credentialsContextKey{}).(*Credentials)
+	return creds
+}
+
+// Keychain describes a store that maps oci references to the credentials of their registries.
+type Keychain interface {
+	// Resolve returns the credentials for the given oci reference.
+	// Nil is returned if no credentials are known for the reference.
+	Resolve(ctx context.Context, ref string) (*Credentials, error)
+}
+
+// KeychainFunc describes a function that can be used as keychain.
+type KeychainFunc func(ctx context.Context, ref string) (*Credentials, error)
+
+func (f KeychainFunc) Resolve(ctx context.Context, ref string) (*Credentials, error) {
+	return f(ctx, ref)
+}
+
+// MultiKeychain combines multiple keychains.
+// The credentials of the first keychain that knows the reference are returned.
+type MultiKeychain []Keychain
+
+var _ Keychain = MultiKeychain{}
+
+// NewMultiKeychain creates a new keychain that combines the given keychains.
+func NewMultiKeychain(keychains ...Keychain) MultiKeychain {
+	return keychains
+}
+
+func (m MultiKeychain) Resolve(ctx context.Context, ref string) (*Credentials, error) {
+	for _, keychain := range m {
+		creds, err := keychain.Resolve(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		if creds != nil {
+			return creds, nil
+		}
+	}
+	return nil, nil
+}
+
+// StaticKeychain is a keychain that maps registry hosts with optional path prefixes to static credentials.
+// If multiple prefixes match a reference the credentials of the longest prefix are used.
+type StaticKeychain struct {
+	mux         sync.RWMutex
+	credentials map[string]Credentials
+}
+
+var _ Keychain = &StaticKeychain{}
+
+// NewStaticKeychain creates a new keychain with the given map of registry prefix to credentials.
+func NewStaticKeychain(creds map[string]Credentials) *StaticKeychain {
+	keychain := &StaticKeychain{
+		credentials: make(map[string]Credentials, len(creds)),
+	}
+	for prefix, c := range creds {
+		keychain.Add(prefix, c)
+	}
+	return keychain
+}
+
+// Add adds or overwrites the credentials for a registry prefix.
+// A prefix is a registry host with an optional path, e.g. "eu.gcr.io/my-project".
+func (k *StaticKeychain) Add(prefix string, creds Credentials) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	k.credentials[NormalizeRef(prefix)] = creds
+}
+
+func (k *StaticKeychain) Resolve(_ context.Context, ref string) (*Credentials, error) {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	prefixes := make([]string, 0, len(k.credentials))
+	for prefix := range k.credentials {
+		prefixes = append(prefixes, prefix)
+	}
+	prefix, ok := MatchPrefix(ref, prefixes)
+	if !ok {
+		return nil, nil
+	}
+	creds := k.credentials[prefix]
+	return &creds, nil
+}
+
+// MatchPrefix returns the longest of the given prefixes that matches the oci reference.
+// A prefix matches if it equals the registry host or
+// if it is a path prefix of the reference that ends at a path, tag or digest separator.
+func MatchPrefix(ref string, prefixes []string) (string, bool) {
+	ref = NormalizeRef(ref)
+	sorted := make([]string, len(prefixes))
+	copy(sorted, prefixes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(NormalizeRef(sorted[i])) > len(NormalizeRef(sorted[j]))
+	})
+	for _, prefix := range sorted {
+		normalized := NormalizeRef(prefix)
+		if len(normalized) == 0 || !strings.HasPrefix(ref, normalized) {
+			continue
+		}
+		if len(ref) == len(normalized) {
+			return prefix, true
+		}
+		switch ref[len(normalized)] {
+		case '/', '@':
+			return prefix, true
+		case ':':
+			// a colon after the host is a port and not a tag separator.
+			if strings.Contains(normalized, "/") {
+				return prefix, true
+			}
+		}
+	}
+	return "", false
+}
+
+// dockerHubAliases are the names that are used for the docker hub registry.
+var dockerHubAliases = map[string]bool{
+	"docker.io":            true,
+	"index.docker.io":      true,
+	"registry-1.docker.io": true,
+}
+
+// NormalizeRef normalizes a oci reference or registry url so that it can be compared with registry prefixes.
+// The url scheme, the docker registry api version path and trailing slashes are removed
+// and all docker hub aliases are mapped to "index.docker.io".
+func NormalizeRef(ref string) string {
+	if i := strings.Index(ref, "://"); i != -1 {
+		ref = ref[i+3:]
+	}
+	ref = strings.TrimSuffix(ref, "/")
+	host, path := ref, ""
+	if i := strings.Index(ref, "/"); i != -1 {
+		host, path = ref[:i], ref[i:]
+	}
+	if path == "/v1" || path == "/v2" {
+		path = ""
+	}
+	if dockerHubAliases[host] {
+		host = "index.docker.io"
+	}
+	return host + path
+}
+
+// RefHost returns the normalized registry host of a oci reference or registry url.
+// All docker hub aliases are mapped to "index.docker.io".
+func RefHost(ref string) string {
+	host := refHost(ref)
+	if dockerHubAliases[host] {
+		return "index.docker.io"
+	}
+	return host
+}
+
+// refHost returns the registry host of a oci reference or registry url as it is written in the reference.
+func refHost(ref string) string {
+	if i := strings.Index(ref, "://"); i != -1 {
+		ref = ref[i+3:]
+	}
+	if i := strings.Index(ref, "/"); i != -1 {
+		return ref[:i]
+	}
+	return ref
+}
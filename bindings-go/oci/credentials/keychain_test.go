@@ -0,0 +1,234 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mandelsoft/vfs/pkg/memoryfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/component-spec/bindings-go/oci/credentials"
+)
+
+var _ = Describe("Keychain", func() {
+
+	Context("StaticKeychain", func() {
+
+		It("should return the credentials of the longest matching prefix", func() {
+			keychain := credentials.NewStaticKeychain(map[string]credentials.Credentials{
+				"example.com":             {Username: "host"},
+				"example.com/project":     {Username: "project"},
+				"https://example.com/pro": {Username: "pro"},
+			})
+
+			creds, err := keychain.Resolve(context.TODO(), "example.com/project/comp:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds.Username).To(Equal("project"))
+
+			creds, err = keychain.Resolve(context.TODO(), "example.com/projects/comp:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds.Username).To(Equal("host"))
+
+			creds, err = keychain.Resolve(context.TODO(), "example.com/pro@sha256:abc")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds.Username).To(Equal("pro"))
+		})
+
+		It("should not match a host with a different port", func() {
+			keychain := credentials.NewStaticKeychain(map[string]credentials.Credentials{
+				"example.com": {Username: "host"},
+			})
+			creds, err := keychain.Resolve(context.TODO(), "example.com:5000/comp:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds).To(BeNil())
+		})
+
+		It("should match docker hub aliases", func() {
+			keychain := credentials.NewStaticKeychain(map[string]credentials.Credentials{
+				"https://index.docker.io/v1/": {Username: "hub"},
+			})
+			creds, err := keychain.Resolve(context.TODO(), "docker.io/library/ubuntu:latest")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds.Username).To(Equal("hub"))
+		})
+
+	})
+
+	Context("DockerConfigKeychain", func() {
+
+		It("should read credentials from the auths of a docker config", func() {
+			fs := memoryfs.New()
+			Expect(vfs.WriteFile(fs, "/config.json", []byte(`{
+  "auths": {
+    "example.com": {"auth": "`+base64.StdEncoding.EncodeToString([]byte("user:pass"))+`"},
+    "other.example.com": {"identitytoken": "token"}
+  }
+}`), os.ModePerm)).To(Succeed())
+			keychain, err := credentials.NewDockerConfigKeychain(fs, "/config.json")
+			Expect(err).ToNot(HaveOccurred())
+
+			creds, err := keychain.Resolve(context.TODO(), "example.com/comp:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds.Username).To(Equal("user"))
+			Expect(creds.Password).To(Equal("pass"))
+
+			creds, err = keychain.Resolve(context.TODO(), "other.example.com/comp:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds.IdentityToken).To(Equal("token"))
+
+			creds, err = keychain.Resolve(context.TODO(), "unknown.example.com/comp:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds).To(BeNil())
+		})
+
+		It("should prefer registry specific credential helpers", func() {
+			keychain, err := credentials.NewDockerConfigKeychainFromBytes([]byte(`{
+  "auths": {"example.com": {"username": "user", "password": "pass"}},
+  "credHelpers": {"example.com": "test"}
+}`))
+			Expect(err).ToNot(HaveOccurred())
+			keychain.WithCredentialHelper(func(ctx context.Context, helper, serverURL string) (*credentials.Credentials, error) {
+				Expect(helper).To(Equal("test"))
+				Expect(serverURL).To(Equal("example.com"))
+				return &credentials.Credentials{Username: "helper"}, nil
+			})
+
+			creds, err := keychain.Resolve(context.TODO(), "example.com/comp:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds.Username).To(Equal("helper"))
+		})
+
+		It("should deterministically choose the credential helper of docker hub aliases", func() {
+			keychain, err := credentials.NewDockerConfigKeychainFromBytes([]byte(`{
+  "credHelpers": {"index.docker.io": "index", "docker.io": "hub"}
+}`))
+			Expect(err).ToNot(HaveOccurred())
+			keychain.WithCredentialHelper(func(ctx context.Context, helper, serverURL string) (*credentials.Credentials, error) {
+				return &credentials.Credentials{Username: helper + "@" + serverURL}, nil
+			})
+
+			for i := 0; i < 10; i++ {
+				creds, err := keychain.Resolve(context.TODO(), "index.docker.io/library/comp:v1")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(creds.Username).To(Equal("index@index.docker.io"), "the exact host should be preferred")
+
+				creds, err = keychain.Resolve(context.TODO(), "docker.io/library/comp:v1")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(creds.Username).To(Equal("hub@docker.io"), "the exact host should be preferred")
+
+				creds, err = keychain.Resolve(context.TODO(), "registry-1.docker.io/library/comp:v1")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(creds.Username).To(Equal("hub@docker.io"), "the alphabetically first alias should be used")
+			}
+		})
+
+		It("should fall back to the auths if the credentials store does not know the registry", func() {
+			keychain, err := credentials.NewDockerConfigKeychainFromBytes([]byte(`{
+  "auths": {"example.com": {"username": "user", "password": "pass"}},
+  "credsStore": "test"
+}`))
+			Expect(err).ToNot(HaveOccurred())
+			keychain.WithCredentialHelper(func(ctx context.Context, helper, serverURL string) (*credentials.Credentials, error) {
+				return nil, nil
+			})
+
+			creds, err := keychain.Resolve(context.TODO(), "example.com/comp:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds.Username).To(Equal("user"))
+		})
+
+		It("should execute a credential helper", func() {
+			dir, err := ioutil.TempDir(os.TempDir(), "cred-helper-")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			script := `#!/bin/sh
+read server
+if [ "$server" = "example.com" ]; then
+  echo '{"ServerURL": "example.com", "Username": "<token>", "Secret": "mytoken"}'
+  exit 0
+fi
+echo "credentials not found in native keychain"
+exit 1
+`
+			Expect(ioutil.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(script), 0755)).To(Succeed())
+			defer os.Setenv("PATH", os.Getenv("PATH"))
+			Expect(os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))).To(Succeed())
+
+			creds, err := credentials.ExecCredentialHelper(context.TODO(), "test", "example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds.IdentityToken).To(Equal("mytoken"))
+
+			creds, err = credentials.ExecCredentialHelper(context.TODO(), "test", "unknown.example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds).To(BeNil())
+		})
+
+	})
+
+	Context("EnvKeychain", func() {
+
+		It("should read credentials from environment variables", func() {
+			keychain, err := credentials.NewEnvKeychain("", []string{
+				"OCI_CREDENTIALS_A_REGISTRY=example.com",
+				"OCI_CREDENTIALS_A_USERNAME=user",
+				"OCI_CREDENTIALS_A_PASSWORD=pass",
+				"OCI_CREDENTIALS_MY_REG_REGISTRY=example.com/project",
+				"OCI_CREDENTIALS_MY_REG_REGISTRY_TOKEN=token",
+				"OTHER=value",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			creds, err := keychain.Resolve(context.TODO(), "example.com/comp:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds.Username).To(Equal("user"))
+			Expect(creds.Password).To(Equal("pass"))
+
+			creds, err = keychain.Resolve(context.TODO(), "example.com/project/comp:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds.RegistryToken).To(Equal("token"))
+			Expect(creds.AuthorizationHeader()).To(Equal("Bearer token"))
+		})
+
+		It("should fail if multiple credentials define the same registry", func() {
+			_, err := credentials.NewEnvKeychain("", []string{
+				"OCI_CREDENTIALS_A_REGISTRY=docker.io",
+				"OCI_CREDENTIALS_A_USERNAME=a",
+				"OCI_CREDENTIALS_B_REGISTRY=https://index.docker.io/v1/",
+				"OCI_CREDENTIALS_B_USERNAME=b",
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(`"A" and "B"`))
+		})
+
+		It("should fail if credentials do not define a registry", func() {
+			_, err := credentials.NewEnvKeychain("", []string{
+				"OCI_CREDENTIALS_A_USERNAME=user",
+			})
+			Expect(err).To(HaveOccurred())
+		})
+
+	})
+
+	It("should return the credentials of the first keychain that knows the reference", func() {
+		keychain := credentials.NewMultiKeychain(
+			credentials.NewStaticKeychain(map[string]credentials.Credentials{"a.example.com": {Username: "a"}}),
+			credentials.NewStaticKeychain(map[string]credentials.Credentials{"example.com": {Username: "b"}, "a.example.com": {Username: "c"}}),
+		)
+		creds, err := keychain.Resolve(context.TODO(), "a.example.com/comp:v1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(creds.Username).To(Equal("a"))
+		creds, err = keychain.Resolve(context.TODO(), "example.com/comp:v1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(creds.Username).To(Equal("b"))
+	})
+
+})
@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+	"github.com/gardener/component-spec/bindings-go/oci"
+)
+
+var _ = Describe("digest pinning", func() {
+
+	var (
+		repoCtx = cdv2.NewOCIRegistryRepository("example.com", "")
+		// manifests maps manifest digests to the component descriptor that is served by the manifest.
+		manifests map[digest.Digest]*cdv2.ComponentDescriptor
+		// tag is the digest of the manifest that is currently tagged with the version.
+		tag    digest.Digest
+		client *testHeadClient
+	)
+
+	BeforeEach(func() {
+		first := defaultComponentDescriptor("example.com/my-comp", "0.0.0")
+		second := defaultComponentDescriptor("example.com/my-comp", "0.0.0")
+		second.Provider = "external"
+		manifests = map[digest.Digest]*cdv2.ComponentDescriptor{
+			digest.FromString("first"):  first,
+			digest.FromString("second"): second,
+		}
+		tag = digest.FromString("first")
+		client = &testHeadClient{
+			testClient: testClient{
+				getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+					splitRef := strings.Split(ref, "@")
+					Expect(splitRef).To(HaveLen(2), "the manifest should be fetched by digest")
+					cd, ok := manifests[digest.Digest(splitRef[1])]
+					if !ok {
+						return nil, errors.New("not found")
+					}
+					return newComponentTestClient(cd, nil, nil).GetManifest(ctx, ref)
+				},
+			},
+			headManifest: func(ctx context.Context, ref string) (ocispecv1.Descriptor, error) {
+				Expect(ref).To(Equal("example.com/component-descriptors/example.com/my-comp:0.0.0"))
+				return ocispecv1.Descriptor{MediaType: ocispecv1.MediaTypeImageManifest, Digest: tag}, nil
+			},
+		}
+		client.fetch = func(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+			splitRef := strings.Split(ref, "@")
+			return newComponentTestClient(manifests[digest.Digest(splitRef[1])], nil, nil).Fetch(ctx, ref, desc, writer)
+		}
+	})
+
+	It("should resolve a version to the digest of its manifest", func() {
+		dgst, err := oci.NewResolver(client).ResolveManifestDigest(context.TODO(), repoCtx, "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dgst).To(Equal(digest.FromString("first")))
+	})
+
+	It("should resolve a component descriptor by digest", func() {
+		cd, err := oci.NewResolver(client).ResolveByDigest(context.TODO(), repoCtx, "example.com/my-comp", digest.FromString("second"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cd.Provider).To(Equal(cdv2.ProviderType("external")))
+	})
+
+	It("should detect a re-pushed version with a digest cache", func() {
+		cache := &testDigestCache{entries: map[digest.Digest]*cdv2.ComponentDescriptor{}}
+		resolver := oci.NewResolver(client).WithCache(cache).WithDigestPinning(true)
+
+		cd, err := resolver.Resolve(context.TODO(), repoCtx, "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cd.Provider).To(Equal(cdv2.ProviderType("internal")))
+		Expect(cache.entries).To(HaveKey(digest.FromString("first")))
+
+		tag = digest.FromString("second")
+		cd, err = resolver.Resolve(context.TODO(), repoCtx, "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cd.Provider).To(Equal(cdv2.ProviderType("external")))
+		Expect(cache.entries).To(HaveKey(digest.FromString("second")))
+		Expect(cache.hits).To(Equal(0))
+
+		_, err = resolver.Resolve(context.TODO(), repoCtx, "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cache.hits).To(Equal(1))
+	})
+
+	It("should return the pinned digest with the component descriptor", func() {
+		cd, blobResolver, dgst, err := oci.NewResolver(client).ResolveWithDigest(context.TODO(), repoCtx, "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dgst).To(Equal(digest.FromString("first")))
+		Expect(cd.Provider).To(Equal(cdv2.ProviderType("internal")))
+		Expect(blobResolver).ToNot(BeNil())
+
+		tag = digest.FromString("second")
+		cd, _, dgst, err = oci.NewResolver(client).ResolveWithDigest(context.TODO(), repoCtx, "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dgst).To(Equal(digest.FromString("second")))
+		Expect(cd.Provider).To(Equal(cdv2.ProviderType("external")))
+	})
+
+	It("should skip a cache that cannot cache by digest when a version is pinned", func() {
+		cache := &testCache{
+			get: func(ctx context.Context, repoCtx cdv2.OCIRegistryRepository, name, version string) (*cdv2.ComponentDescriptor, error) {
+				Expect(false).To(BeTrue(), "should not be called")
+				return nil, nil
+			},
+			store: func(ctx context.Context, descriptor *cdv2.ComponentDescriptor) error {
+				Expect(false).To(BeTrue(), "should not be called")
+				return nil
+			},
+		}
+		cd, err := oci.NewResolver(client).WithCache(cache).WithDigestPinning(true).Resolve(context.TODO(), repoCtx, "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cd.Provider).To(Equal(cdv2.ProviderType("internal")))
+	})
+
+	It("should fail to pin a version if the client cannot resolve manifest digests", func() {
+		_, err := oci.NewResolver(&client.testClient).WithDigestPinning(true).Resolve(context.TODO(), repoCtx, "example.com/my-comp", "0.0.0")
+		Expect(errors.Is(err, oci.HeadManifestNotSupportedError)).To(BeTrue())
+	})
+
+	It("should forward manifest digest resolution through middlewares", func() {
+		wrapped := oci.WrapClient(client, oci.WithRetry(oci.RetryOptions{}), oci.WithTimeout(time.Minute), oci.WithRateLimit(0, 1))
+		dgst, err := oci.NewResolver(wrapped).ResolveManifestDigest(context.TODO(), repoCtx, "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dgst).To(Equal(digest.FromString("first")))
+	})
+
+})
+
+// testHeadClient describes a test oci client that is able to resolve manifest digests.
+type testHeadClient struct {
+	testClient
+	headManifest func(ctx context.Context, ref string) (ocispecv1.Descriptor, error)
+}
+
+var _ oci.ManifestHeadClient = &testHeadClient{}
+
+func (t testHeadClient) HeadManifest(ctx context.Context, ref string) (ocispecv1.Descriptor, error) {
+	return t.headManifest(ctx, ref)
+}
+
+// testDigestCache describes a test cache that caches component descriptors by their manifest digest.
+type testDigestCache struct {
+	entries map[digest.Digest]*cdv2.ComponentDescriptor
+	hits    int
+}
+
+var _ oci.DigestCache = &testDigestCache{}
+
+func (t *testDigestCache) Get(_ context.Context, _ cdv2.OCIRegistryRepository, _, _ string) (*cdv2.ComponentDescriptor, error) {
+	Expect(false).To(BeTrue(), "should not be called")
+	return nil, nil
+}
+
+func (t *testDigestCache) Store(_ context.Context, _ *cdv2.ComponentDescriptor) error {
+	Expect(false).To(BeTrue(), "should not be called")
+	return nil
+}
+
+func (t *testDigestCache) GetByDigest(_ context.Context, _ cdv2.OCIRegistryRepository, _ string, dgst digest.Digest) (*cdv2.ComponentDescriptor, error) {
+	cd, ok := t.entries[dgst]
+	if !ok {
+		return nil, ctf.NotFoundError
+	}
+	t.hits++
+	return cd.DeepCopy(), nil
+}
+
+func (t *testDigestCache) StoreByDigest(_ context.Context, dgst digest.Digest, descriptor *cdv2.ComponentDescriptor) error {
+	t.entries[dgst] = descriptor
+	return nil
+}
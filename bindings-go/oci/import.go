@@ -0,0 +1,195 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	v2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+)
+
+// PushClient defines an oci artifact client that is also able to upload blobs and manifests.
+type PushClient interface {
+	Client
+
+	// PushBlob uploads the blob for the given ocispec Descriptor to the repository of the reference.
+	PushBlob(ctx context.Context, ref string, desc ocispecv1.Descriptor, reader io.Reader) error
+
+	// PushManifest uploads the manifest and tags it with the reference.
+	PushManifest(ctx context.Context, ref string, manifest *ocispecv1.Manifest) error
+}
+
+// ImportOptions defines the options for importing a ctf into an oci registry.
+type ImportOptions struct {
+	// Overwrite defines whether components that already exist in the registry are pushed again.
+	// By default existing components are skipped.
+	Overwrite bool
+	// StorageType is the storage type of the component descriptor layer.
+	// Defaults to ComponentDescriptorTarMimeType.
+	StorageType string
+}
+
+// ApplyOptions applies the given list options on these options,
+// and then returns itself (for convenient chaining).
+func (o *ImportOptions) ApplyOptions(opts []ImportOption) *ImportOptions {
+	for _, opt := range opts {
+		if opt != nil {
+			opt.ApplyImportOption(o)
+		}
+	}
+	return o
+}
+
+// ImportOption is the interface to specify different import options.
+type ImportOption interface {
+	ApplyImportOption(options *ImportOptions)
+}
+
+// ImportOverwrite configures whether existing components are pushed again.
+type ImportOverwrite bool
+
+// ApplyImportOption applies the configured overwrite option.
+func (o ImportOverwrite) ApplyImportOption(options *ImportOptions) {
+	options.Overwrite = bool(o)
+}
+
+// ImportStorageType configures the storage type of the component descriptor layer.
+type ImportStorageType string
+
+// ApplyImportOption applies the configured storage type.
+func (t ImportStorageType) ApplyImportOption(options *ImportOptions) {
+	options.StorageType = string(t)
+}
+
+// ImportedComponent describes a component of an import.
+type ImportedComponent struct {
+	Name    string
+	Version string
+	// Ref is the oci reference of the component in the target registry.
+	Ref string
+}
+
+// ImportReport summarizes an import.
+type ImportReport struct {
+	// Pushed are the components that have been pushed to the registry.
+	Pushed []ImportedComponent
+	// Skipped are the components that already existed in the registry.
+	Skipped []ImportedComponent
+}
+
+// ImportCTF pushes all component archives of the ctf to the given oci registry.
+// Local blobs are uploaded as layers of the component manifest
+// and the repository is added as repository context to the component descriptors.
+// The manifest of a component is pushed after all of its blobs,
+// so that an import that failed partially can be resumed by importing the ctf again:
+// components whose manifest already exists are skipped unless overwrite is configured.
+// On error, the report of all components that have been imported so far is returned together with the error.
+func ImportCTF(ctx context.Context, client PushClient, repoCtx v2.OCIRegistryRepository, ctfArchive *ctf.CTF, opts ...ImportOption) (*ImportReport, error) {
+	options := (&ImportOptions{}).ApplyOptions(opts)
+	if err := checkRepositoryType(repoCtx); err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{
+		Pushed:  make([]ImportedComponent, 0),
+		Skipped: make([]ImportedComponent, 0),
+	}
+	list, err := ctfArchive.List()
+	if err != nil {
+		return report, err
+	}
+	for _, info := range list {
+		ref, err := OCIRef(repoCtx, info.Name, info.Version)
+		if err != nil {
+			return report, fmt.Errorf("unable to generate oci reference for %q %q: %w", info.Name, info.Version, err)
+		}
+		component := ImportedComponent{
+			Name:    info.Name,
+			Version: info.Version,
+			Ref:     ref,
+		}
+
+		if !options.Overwrite {
+			exists, err := manifestExists(ctx, client, ref)
+			if err != nil {
+				return report, fmt.Errorf("unable to check whether %s exists: %w", ref, err)
+			}
+			if exists {
+				report.Skipped = append(report.Skipped, component)
+				continue
+			}
+		}
+
+		// the component archive with all of its blobs is only read if the component is pushed.
+		ca, err := ctfArchive.ReadComponentArchive(info.Path)
+		if err != nil {
+			return report, err
+		}
+		if err := pushComponentArchive(ctx, client, repoCtx, ref, ca, options); err != nil {
+			return report, fmt.Errorf("unable to push component %q %q: %w", info.Name, info.Version, err)
+		}
+		report.Pushed = append(report.Pushed, component)
+	}
+	return report, nil
+}
+
+// pushComponentArchive uploads all blobs of the component archive and then its manifest.
+func pushComponentArchive(ctx context.Context, client PushClient, repoCtx v2.OCIRegistryRepository, ref string, ca *ctf.ComponentArchive, options *ImportOptions) error {
+	if err := v2.InjectRepositoryContext(ca.ComponentDescriptor, &repoCtx); err != nil {
+		return fmt.Errorf("unable to add repository context: %w", err)
+	}
+	store := &pushBlobStore{
+		ctx:    ctx,
+		client: client,
+		ref:    ref,
+	}
+	manifest, err := NewManifestBuilder(store, ca).StorageType(options.StorageType).Build(ctx)
+	if err != nil {
+		return err
+	}
+	if err := client.PushManifest(ctx, ref, manifest); err != nil {
+		return fmt.Errorf("unable to push manifest: %w", err)
+	}
+	return nil
+}
+
+// manifestExists returns whether the registry contains a manifest for the reference.
+// The manifest descriptor is requested if the client implements the ManifestHeadClient interface,
+// otherwise the manifest is fetched.
+func manifestExists(ctx context.Context, client Client, ref string) (bool, error) {
+	_, err := headManifest(ctx, client, ref)
+	if errors.Is(err, HeadManifestNotSupportedError) {
+		_, err = client.GetManifest(ctx, ref)
+	}
+	if err == nil {
+		return true, nil
+	}
+	statusErr := &StatusError{}
+	if errors.Is(err, ctf.NotFoundError) || (errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound) {
+		return false, nil
+	}
+	return false, err
+}
+
+// pushBlobStore is a blob store that directly uploads all blobs to the repository of a reference.
+type pushBlobStore struct {
+	ctx    context.Context
+	client PushClient
+	ref    string
+}
+
+var _ BlobStore = &pushBlobStore{}
+
+func (s *pushBlobStore) Add(desc ocispecv1.Descriptor, reader io.ReadCloser) error {
+	defer reader.Close()
+	return s.client.PushBlob(s.ctx, s.ref, desc, reader)
+}
@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/mandelsoft/vfs/pkg/memoryfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
+	"github.com/gardener/component-spec/bindings-go/oci"
+)
+
+var _ = Describe("import", func() {
+
+	newCTF := func(archives ...*ctf.ComponentArchive) *ctf.CTF {
+		fs := memoryfs.New()
+		Expect(vfs.WriteFile(fs, "/ctf.tar", []byte{}, os.ModePerm)).To(Succeed())
+		ctfArchive, err := ctf.NewCTF(fs, "/ctf.tar")
+		Expect(err).ToNot(HaveOccurred())
+		for _, ca := range archives {
+			Expect(ctfArchive.AddComponentArchive(ca, ctf.ArchiveFormatTar)).To(Succeed())
+		}
+		return ctfArchive
+	}
+
+	It("should push all components of a ctf with their local blobs", func() {
+		ctx := context.Background()
+		data := []byte("resource blob")
+		a := ctf.NewComponentArchive(defaultComponentDescriptor("example.com/a", "1.0.0"), memoryfs.New())
+		Expect(a.AddResource(&cdv2.Resource{
+			IdentityObjectMeta: cdv2.IdentityObjectMeta{Name: "res", Version: "1.0.0", Type: "blob"},
+			Relation:           cdv2.LocalRelation,
+		}, ctf.BlobInfo{MediaType: "text/plain", Digest: digest.FromBytes(data).String(), Size: int64(len(data))}, bytes.NewBuffer(data))).To(Succeed())
+		b := ctf.NewComponentArchive(defaultComponentDescriptor("example.com/b", "1.0.0"), memoryfs.New())
+		ctfArchive := newCTF(a, b)
+		defer ctfArchive.Close()
+
+		registry := newMemoryRegistry()
+		repoCtx := cdv2.NewOCIRegistryRepository("example.com/target", "")
+		report, err := oci.ImportCTF(ctx, registry, *repoCtx, ctfArchive)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Pushed).To(HaveLen(2))
+		Expect(report.Skipped).To(BeEmpty())
+
+		cd, blobResolver, err := oci.NewResolver(registry).ResolveWithBlobResolver(ctx, repoCtx, "example.com/a", "1.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cd.GetEffectiveRepositoryContext().Object["baseUrl"]).To(Equal("example.com/target"))
+		Expect(cd.Resources[0].Access.GetType()).To(Equal(cdv2.LocalOCIBlobType))
+		var blob bytes.Buffer
+		_, err = blobResolver.Resolve(ctx, cd.Resources[0], &blob)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blob.Bytes()).To(Equal(data))
+	})
+
+	It("should resume a partially failed import", func() {
+		ctx := context.Background()
+		ctfArchive := newCTF(
+			ctf.NewComponentArchive(defaultComponentDescriptor("example.com/a", "1.0.0"), memoryfs.New()),
+			ctf.NewComponentArchive(defaultComponentDescriptor("example.com/b", "1.0.0"), memoryfs.New()),
+		)
+		defer ctfArchive.Close()
+
+		registry := newMemoryRegistry()
+		pushes := 0
+		registry.pushManifestHook = func(ref string) error {
+			pushes++
+			if pushes == 2 {
+				return &oci.StatusError{StatusCode: http.StatusServiceUnavailable}
+			}
+			return nil
+		}
+		repoCtx := cdv2.NewOCIRegistryRepository("example.com/target", "")
+		report, err := oci.ImportCTF(ctx, registry, *repoCtx, ctfArchive)
+		Expect(err).To(HaveOccurred())
+		Expect(report.Pushed).To(HaveLen(1))
+
+		report, err = oci.ImportCTF(ctx, registry, *repoCtx, ctfArchive)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Skipped).To(HaveLen(1))
+		Expect(report.Pushed).To(HaveLen(1))
+		Expect(report.Pushed[0].Name).ToNot(Equal(report.Skipped[0].Name))
+
+		report, err = oci.ImportCTF(ctx, registry, *repoCtx, ctfArchive, oci.ImportOverwrite(true))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Pushed).To(HaveLen(2))
+		Expect(report.Skipped).To(BeEmpty())
+	})
+
+	It("should not read the component archives of skipped components", func() {
+		ctx := context.Background()
+		fs := memoryfs.New()
+		Expect(fs.MkdirAll("/ctf", os.ModePerm)).To(Succeed())
+		ctfArchive, err := ctf.NewCTF(fs, "/ctf")
+		Expect(err).ToNot(HaveOccurred())
+		data := bytes.Repeat([]byte("a"), 4096)
+		a := ctf.NewComponentArchive(defaultComponentDescriptor("example.com/a", "1.0.0"), memoryfs.New())
+		Expect(a.AddResource(&cdv2.Resource{
+			IdentityObjectMeta: cdv2.IdentityObjectMeta{Name: "res", Version: "1.0.0", Type: "blob"},
+			Relation:           cdv2.LocalRelation,
+		}, ctf.BlobInfo{MediaType: "text/plain", Digest: digest.FromBytes(data).String(), Size: int64(len(data))}, bytes.NewBuffer(data))).To(Succeed())
+		Expect(ctfArchive.AddComponentArchive(a, ctf.ArchiveFormatTar)).To(Succeed())
+		Expect(ctfArchive.Close()).To(Succeed())
+
+		// the blob exceeds the maximal file size, so that the component archive cannot be read.
+		ctfArchive, err = ctf.NewCTF(fs, "/ctf", ctf.MaxFileSize(1024))
+		Expect(err).ToNot(HaveOccurred())
+		defer ctfArchive.Close()
+
+		registry := newMemoryRegistry()
+		repoCtx := cdv2.NewOCIRegistryRepository("example.com/target", "")
+		ref, err := oci.OCIRef(*repoCtx, "example.com/a", "1.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		registry.manifests[ref] = &ocispecv1.Manifest{}
+
+		report, err := oci.ImportCTF(ctx, registry, *repoCtx, ctfArchive)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Skipped).To(HaveLen(1))
+		Expect(report.Pushed).To(BeEmpty())
+
+		_, err = oci.ImportCTF(ctx, registry, *repoCtx, ctfArchive, oci.ImportOverwrite(true))
+		Expect(err).To(HaveOccurred())
+	})
+
+})
+
+// memoryRegistry is a push client that keeps all manifests and blobs in memory.
+type memoryRegistry struct {
+	manifests map[string]*ocispecv1.Manifest
+	blobs     map[string][]byte
+	// pushManifestHook is optionally called before a manifest is pushed and can be used to inject errors.
+	pushManifestHook func(ref string) error
+}
+
+var _ oci.PushClient = &memoryRegistry{}
+
+func newMemoryRegistry() *memoryRegistry {
+	return &memoryRegistry{
+		manifests: map[string]*ocispecv1.Manifest{},
+		blobs:     map[string][]byte{},
+	}
+}
+
+func (r *memoryRegistry) GetManifest(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+	manifest, ok := r.manifests[ref]
+	if !ok {
+		return nil, &oci.StatusError{StatusCode: http.StatusNotFound}
+	}
+	return manifest, nil
+}
+
+func (r *memoryRegistry) Fetch(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+	blob, ok := r.blobs[desc.Digest.String()]
+	if !ok {
+		return errors.New("unknown desc")
+	}
+	_, err := writer.Write(blob)
+	return err
+}
+
+func (r *memoryRegistry) PushBlob(ctx context.Context, ref string, desc ocispecv1.Descriptor, reader io.Reader) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	r.blobs[desc.Digest.String()] = data
+	return nil
+}
+
+func (r *memoryRegistry) PushManifest(ctx context.Context, ref string, manifest *ocispecv1.Manifest) error {
+	if r.pushManifestHook != nil {
+		if err := r.pushManifestHook(ref); err != nil {
+			return err
+		}
+	}
+	r.manifests[ref] = manifest
+	return nil
+}
@@ -155,7 +155,7 @@ func (b *ManifestBuilder) addComponentDescriptorDesc() (ocispecv1.Descriptor, er
 	return ocispecv1.Descriptor{}, fmt.Errorf("unsupported storage type %q", b.componentDescriptorStorageType)
 }
 
-// addLocalBlobs adds all local resources to the blob store and updates the component descriptors access method.
+// addLocalBlobs adds all local resources and sources to the blob store and updates the component descriptors access method.
 func (b *ManifestBuilder) addLocalBlobs(ctx context.Context) ([]ocispecv1.Descriptor, error) {
 	blobDescriptors := make([]ocispecv1.Descriptor, 0)
 
@@ -187,5 +187,34 @@ func (b *ManifestBuilder) addLocalBlobs(ctx context.Context) ([]ocispecv1.Descri
 		b.archive.ComponentDescriptor.Resources[i] = res
 		blobDescriptors = append(blobDescriptors, desc)
 	}
+
+	for i, src := range b.archive.ComponentDescriptor.Sources {
+		var blob bytes.Buffer
+		info, err := b.archive.ResolveSource(ctx, src, &blob)
+		if err != nil {
+			if err == ctf.UnsupportedResolveType {
+				continue
+			}
+			return nil, fmt.Errorf("unable to get blob for source %s: %w", src.GetName(), err)
+		}
+
+		desc := ocispecv1.Descriptor{
+			MediaType: info.MediaType,
+			Digest:    digest.Digest(info.Digest),
+			Size:      info.Size,
+		}
+		if err := b.store.Add(desc, ioutil.NopCloser(&blob)); err != nil {
+			return nil, fmt.Errorf("unable to store blob: %w", err)
+		}
+
+		ociBlobAccess := v2.NewLocalOCIBlobAccess(desc.Digest.String())
+		unstructuredType, err := v2.NewUnstructured(ociBlobAccess)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert ociBlob to untructured type: %w", err)
+		}
+		src.Access = &unstructuredType
+		b.archive.ComponentDescriptor.Sources[i] = src
+		blobDescriptors = append(blobDescriptors, desc)
+	}
 	return blobDescriptors, nil
 }
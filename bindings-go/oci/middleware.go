@@ -0,0 +1,481 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/gardener/component-spec/bindings-go/oci/credentials"
+)
+
+// ClientMiddleware describes a function that decorates a client with additional behavior.
+type ClientMiddleware func(client Client) Client
+
+// WrapClient decorates the client with the given middlewares.
+// The first middleware is the outermost one, so that "WrapClient(client, WithRetry(RetryOptions{}), WithTimeout(time.Minute))"
+// retries requests that did not complete within a minute.
+func WrapClient(client Client, middlewares ...ClientMiddleware) Client {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		client = middlewares[i](client)
+	}
+	return client
+}
+
+// StatusError describes an error response of a registry.
+// Clients should return this error so that the middlewares are able to
+// decide whether a request can be retried.
+type StatusError struct {
+	// StatusCode is the http status code of the response.
+	StatusCode int
+	// RetryAfter is the duration the registry asks to wait before the next request.
+	// It is zero if the registry did not send a "Retry-After" header.
+	RetryAfter time.Duration
+	// Err is the optional underlying error.
+	Err error
+}
+
+var _ error = &StatusError{}
+
+func (e *StatusError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("unexpected status code %d: %s", e.StatusCode, e.Err.Error())
+	}
+	return fmt.Sprintf("unexpected status code %d", e.StatusCode)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// NewStatusErrorFromResponse creates a status error from a http response.
+// The "Retry-After" header of the response is parsed if present.
+func NewStatusErrorFromResponse(resp *http.Response) *StatusError {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// ParseRetryAfter parses the value of a "Retry-After" header.
+// The value can either be a number of seconds or a http date.
+// Zero is returned if the value cannot be parsed or lies in the past.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0
+	}
+	if d := date.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// IsRetryableError returns whether a failed request can be retried.
+// Requests are retried if the registry responded with 429 or a 5xx status code (except 501),
+// if the request timed out or if a temporary network error occurred.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	statusErr := &StatusError{}
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests ||
+			(statusErr.StatusCode >= 500 && statusErr.StatusCode != http.StatusNotImplemented)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+	return false
+}
+
+// RetryOptions defines the options for the retry middleware.
+// Unset values are defaulted.
+type RetryOptions struct {
+	// MaxRetries is the maximum number of retries of a request.
+	// Defaults to 5.
+	MaxRetries int
+	// InitialBackoff is the time to wait before the first retry.
+	// Defaults to 500ms.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum time to wait between two retries.
+	// A "Retry-After" duration requested by the registry is not capped.
+	// Defaults to 30s.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the backoff is increased with after every retry.
+	// Defaults to 2.
+	Multiplier float64
+	// IsRetryable decides whether a failed request is retried.
+	// Defaults to IsRetryableError.
+	IsRetryable func(err error) bool
+}
+
+// Default defaults all unset retry options.
+func (o *RetryOptions) Default() {
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 5
+	}
+	if o.InitialBackoff == 0 {
+		o.InitialBackoff = 500 * time.Millisecond
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = 30 * time.Second
+	}
+	if o.Multiplier < 1 {
+		o.Multiplier = 2
+	}
+	if o.IsRetryable == nil {
+		o.IsRetryable = IsRetryableError
+	}
+}
+
+// WithRetry returns a middleware that retries failed requests with an exponential backoff.
+// A retried fetch does not write the bytes that were already written by a previous attempt
+// so that the writer receives the blob exactly once.
+func WithRetry(opts RetryOptions) ClientMiddleware {
+	opts.Default()
+	return func(client Client) Client {
+		return &retryClient{
+			client: client,
+			opts:   opts,
+		}
+	}
+}
+
+type retryClient struct {
+	client Client
+	opts   RetryOptions
+}
+
+func (c *retryClient) GetManifest(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+	var manifest *ocispecv1.Manifest
+	err := c.do(ctx, func() error {
+		var err error
+		manifest, err = c.client.GetManifest(ctx, ref)
+		return err
+	})
+	return manifest, err
+}
+
+func (c *retryClient) HeadManifest(ctx context.Context, ref string) (ocispecv1.Descriptor, error) {
+	var desc ocispecv1.Descriptor
+	err := c.do(ctx, func() error {
+		var err error
+		desc, err = headManifest(ctx, c.client, ref)
+		return err
+	})
+	return desc, err
+}
+
+func (c *retryClient) Fetch(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+	rw := &resumeWriter{writer: writer}
+	return c.do(ctx, func() error {
+		rw.Reset()
+		return c.client.Fetch(ctx, ref, desc, rw)
+	})
+}
+
+func (c *retryClient) do(ctx context.Context, fn func() error) error {
+	backoff := c.opts.InitialBackoff
+	for retries := 0; ; retries++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || retries >= c.opts.MaxRetries || !c.opts.IsRetryable(err) {
+			return err
+		}
+
+		wait := backoff
+		statusErr := &StatusError{}
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			wait = statusErr.RetryAfter
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+
+		backoff = time.Duration(float64(backoff) * c.opts.Multiplier)
+		if backoff > c.opts.MaxBackoff {
+			backoff = c.opts.MaxBackoff
+		}
+	}
+}
+
+// resumeWriter is a writer that is reused for multiple attempts of the same fetch.
+// Only the bytes that exceed the bytes written by previous attempts are passed to the underlying writer.
+type resumeWriter struct {
+	writer io.Writer
+	// written is the number of bytes that have been written to the underlying writer.
+	written int64
+	// pos is the number of bytes that have been written in the current attempt.
+	pos int64
+}
+
+// Reset starts a new attempt.
+func (w *resumeWriter) Reset() {
+	w.pos = 0
+}
+
+func (w *resumeWriter) Write(p []byte) (int, error) {
+	n := int64(len(p))
+	if w.pos+n <= w.written {
+		w.pos += n
+		return len(p), nil
+	}
+	skip := int64(0)
+	if w.pos < w.written {
+		skip = w.written - w.pos
+	}
+	written, err := w.writer.Write(p[skip:])
+	w.written += int64(written)
+	w.pos += skip + int64(written)
+	return int(skip) + written, err
+}
+
+// WithTimeout returns a middleware that cancels a request if it does not complete within the given timeout.
+func WithTimeout(timeout time.Duration) ClientMiddleware {
+	return func(client Client) Client {
+		return &timeoutClient{
+			client:  client,
+			timeout: timeout,
+		}
+	}
+}
+
+type timeoutClient struct {
+	client  Client
+	timeout time.Duration
+}
+
+func (c *timeoutClient) GetManifest(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.client.GetManifest(ctx, ref)
+}
+
+func (c *timeoutClient) HeadManifest(ctx context.Context, ref string) (ocispecv1.Descriptor, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return headManifest(ctx, c.client, ref)
+}
+
+func (c *timeoutClient) Fetch(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.client.Fetch(ctx, ref, desc, writer)
+}
+
+// WithRateLimit returns a middleware that limits the requests per registry host.
+// Docker hub aliases share the same limit.
+// Every host may be called requestsPerSecond times per second with bursts of up to burst requests.
+// A rate of zero or less disables the limit.
+func WithRateLimit(requestsPerSecond float64, burst int) ClientMiddleware {
+	if burst < 1 {
+		burst = 1
+	}
+	return func(client Client) Client {
+		return &rateLimitClient{
+			client:  client,
+			rate:    requestsPerSecond,
+			burst:   burst,
+			buckets: map[string]*tokenBucket{},
+		}
+	}
+}
+
+type rateLimitClient struct {
+	client Client
+	rate   float64
+	burst  int
+
+	mux     sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func (c *rateLimitClient) GetManifest(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+	if err := c.wait(ctx, ref); err != nil {
+		return nil, err
+	}
+	return c.client.GetManifest(ctx, ref)
+}
+
+func (c *rateLimitClient) HeadManifest(ctx context.Context, ref string) (ocispecv1.Descriptor, error) {
+	if err := c.wait(ctx, ref); err != nil {
+		return ocispecv1.Descriptor{}, err
+	}
+	return headManifest(ctx, c.client, ref)
+}
+
+func (c *rateLimitClient) Fetch(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+	if err := c.wait(ctx, ref); err != nil {
+		return err
+	}
+	return c.client.Fetch(ctx, ref, desc, writer)
+}
+
+// wait blocks until a request to the host of the given reference is allowed.
+func (c *rateLimitClient) wait(ctx context.Context, ref string) error {
+	host := credentials.RefHost(ref)
+	c.mux.Lock()
+	bucket, ok := c.buckets[host]
+	if !ok {
+		bucket = newTokenBucket(c.rate, c.burst)
+		c.buckets[host] = bucket
+	}
+	c.mux.Unlock()
+
+	delay := bucket.Reserve(time.Now())
+	if err := sleep(ctx, delay); err != nil {
+		bucket.Cancel()
+		return err
+	}
+	return nil
+}
+
+// WithKeychain returns a middleware that resolves the credentials of every request from the given keychain.
+// The credentials are passed to the wrapped client with the request context
+// so that the client can read them with credentials.FromContext.
+// Requests to references that are unknown to the keychain are passed without credentials.
+func WithKeychain(keychain credentials.Keychain) ClientMiddleware {
+	return func(client Client) Client {
+		return &keychainClient{
+			client:   client,
+			keychain: keychain,
+		}
+	}
+}
+
+type keychainClient struct {
+	client   Client
+	keychain credentials.Keychain
+}
+
+func (c *keychainClient) GetManifest(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+	ctx, err := c.withCredentials(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.GetManifest(ctx, ref)
+}
+
+func (c *keychainClient) HeadManifest(ctx context.Context, ref string) (ocispecv1.Descriptor, error) {
+	ctx, err := c.withCredentials(ctx, ref)
+	if err != nil {
+		return ocispecv1.Descriptor{}, err
+	}
+	return headManifest(ctx, c.client, ref)
+}
+
+func (c *keychainClient) Fetch(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+	ctx, err := c.withCredentials(ctx, ref)
+	if err != nil {
+		return err
+	}
+	return c.client.Fetch(ctx, ref, desc, writer)
+}
+
+// withCredentials returns a context that carries the credentials of the given reference.
+func (c *keychainClient) withCredentials(ctx context.Context, ref string) (context.Context, error) {
+	creds, err := c.keychain.Resolve(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve credentials for %q: %w", ref, err)
+	}
+	if creds == nil {
+		return ctx, nil
+	}
+	return credentials.NewContext(ctx, creds), nil
+}
+
+// tokenBucket implements a token bucket rate limiter.
+type tokenBucket struct {
+	mux    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Reserve takes a token from the bucket and returns the time to wait until the token is available.
+func (b *tokenBucket) Reserve(now time.Time) time.Duration {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 || b.rate <= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Cancel returns a reserved token to the bucket.
+func (b *tokenBucket) Cancel() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.tokens++
+}
+
+// headManifest calls the HeadManifest function of the client
+// or returns a HeadManifestNotSupportedError if the client does not implement the ManifestHeadClient interface.
+func headManifest(ctx context.Context, client Client, ref string) (ocispecv1.Descriptor, error) {
+	headClient, ok := client.(ManifestHeadClient)
+	if !ok {
+		return ocispecv1.Descriptor{}, HeadManifestNotSupportedError
+	}
+	return headClient.HeadManifest(ctx, ref)
+}
+
+// sleep waits for the given duration or until the context is canceled.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
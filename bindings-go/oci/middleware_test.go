@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/gardener/component-spec/bindings-go/oci"
+	"github.com/gardener/component-spec/bindings-go/oci/credentials"
+)
+
+var _ = Describe("middleware", func() {
+
+	fastRetry := oci.RetryOptions{
+		MaxRetries:     3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+
+	Context("Retry", func() {
+
+		It("should retry a request that failed with a retryable status code", func() {
+			calls := 0
+			client := oci.WrapClient(&testClient{
+				getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+					calls++
+					if calls < 3 {
+						return nil, &oci.StatusError{StatusCode: http.StatusServiceUnavailable}
+					}
+					return &ocispecv1.Manifest{}, nil
+				},
+			}, oci.WithRetry(fastRetry))
+
+			_, err := client.GetManifest(context.TODO(), "example.com/a:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls).To(Equal(3))
+		})
+
+		It("should not retry a request that failed with a non retryable status code", func() {
+			calls := 0
+			client := oci.WrapClient(&testClient{
+				getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+					calls++
+					return nil, &oci.StatusError{StatusCode: http.StatusNotFound}
+				},
+			}, oci.WithRetry(fastRetry))
+
+			_, err := client.GetManifest(context.TODO(), "example.com/a:v1")
+			Expect(err).To(HaveOccurred())
+			Expect(calls).To(Equal(1))
+		})
+
+		It("should stop after the maximum number of retries", func() {
+			calls := 0
+			client := oci.WrapClient(&testClient{
+				getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+					calls++
+					return nil, &oci.StatusError{StatusCode: http.StatusTooManyRequests}
+				},
+			}, oci.WithRetry(fastRetry))
+
+			_, err := client.GetManifest(context.TODO(), "example.com/a:v1")
+			statusErr := &oci.StatusError{}
+			Expect(errors.As(err, &statusErr)).To(BeTrue())
+			Expect(statusErr.StatusCode).To(Equal(http.StatusTooManyRequests))
+			Expect(calls).To(Equal(4))
+		})
+
+		It("should wait the duration requested by the registry", func() {
+			calls := 0
+			client := oci.WrapClient(&testClient{
+				getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+					calls++
+					if calls == 1 {
+						return nil, &oci.StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 50 * time.Millisecond}
+					}
+					return &ocispecv1.Manifest{}, nil
+				},
+			}, oci.WithRetry(fastRetry))
+
+			start := time.Now()
+			_, err := client.GetManifest(context.TODO(), "example.com/a:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		})
+
+		It("should not write duplicate bytes if a fetch is retried", func() {
+			calls := 0
+			client := oci.WrapClient(&testClient{
+				fetch: func(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+					calls++
+					if calls == 1 {
+						if _, err := writer.Write([]byte("abc")); err != nil {
+							return err
+						}
+						return &oci.StatusError{StatusCode: http.StatusBadGateway}
+					}
+					_, err := io.Copy(writer, bytes.NewBufferString("abcdef"))
+					return err
+				},
+			}, oci.WithRetry(fastRetry))
+
+			var data bytes.Buffer
+			Expect(client.Fetch(context.TODO(), "example.com/a:v1", ocispecv1.Descriptor{}, &data)).To(Succeed())
+			Expect(data.String()).To(Equal("abcdef"))
+		})
+
+		It("should retry requests that exceeded the request timeout", func() {
+			calls := 0
+			client := oci.WrapClient(&testClient{
+				getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+					calls++
+					if calls == 1 {
+						<-ctx.Done()
+						return nil, ctx.Err()
+					}
+					return &ocispecv1.Manifest{}, nil
+				},
+			}, oci.WithRetry(fastRetry), oci.WithTimeout(10*time.Millisecond))
+
+			_, err := client.GetManifest(context.TODO(), "example.com/a:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls).To(Equal(2))
+		})
+
+	})
+
+	Context("RateLimit", func() {
+
+		It("should limit the requests per host", func() {
+			client := oci.WrapClient(&testClient{
+				getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+					return &ocispecv1.Manifest{}, nil
+				},
+			}, oci.WithRateLimit(20, 1))
+
+			start := time.Now()
+			for i := 0; i < 3; i++ {
+				_, err := client.GetManifest(context.TODO(), "example.com/a:v1")
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(time.Since(start)).To(BeNumerically(">=", 90*time.Millisecond))
+
+			start = time.Now()
+			_, err := client.GetManifest(context.TODO(), "other.example.com/a:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically("<", 40*time.Millisecond))
+		})
+
+		It("should abort waiting if the context is canceled", func() {
+			client := oci.WrapClient(&testClient{
+				getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+					return &ocispecv1.Manifest{}, nil
+				},
+			}, oci.WithRateLimit(0.1, 1))
+
+			_, err := client.GetManifest(context.TODO(), "example.com/a:v1")
+			Expect(err).ToNot(HaveOccurred())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err = client.GetManifest(ctx, "example.com/a:v1")
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		})
+
+	})
+
+	Context("Keychain", func() {
+
+		It("should pass the credentials of the keychain to the client", func() {
+			keychain := credentials.NewStaticKeychain(map[string]credentials.Credentials{
+				"example.com/project": {Username: "user", Password: "pass"},
+			})
+			var manifestCreds, fetchCreds *credentials.Credentials
+			client := oci.WrapClient(&testClient{
+				getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+					manifestCreds = credentials.FromContext(ctx)
+					return &ocispecv1.Manifest{}, nil
+				},
+				fetch: func(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+					fetchCreds = credentials.FromContext(ctx)
+					return nil
+				},
+			}, oci.WithKeychain(keychain))
+
+			_, err := client.GetManifest(context.TODO(), "example.com/project/a:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manifestCreds).ToNot(BeNil())
+			Expect(manifestCreds.Username).To(Equal("user"))
+
+			Expect(client.Fetch(context.TODO(), "example.com/other/a:v1", ocispecv1.Descriptor{}, io.Discard)).To(Succeed())
+			Expect(fetchCreds).To(BeNil())
+		})
+
+		It("should fail if the credentials cannot be resolved", func() {
+			called := false
+			client := oci.WrapClient(&testClient{
+				getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+					called = true
+					return &ocispecv1.Manifest{}, nil
+				},
+			}, oci.WithKeychain(credentials.KeychainFunc(func(ctx context.Context, ref string) (*credentials.Credentials, error) {
+				return nil, errors.New("keychain failed")
+			})))
+
+			_, err := client.GetManifest(context.TODO(), "example.com/a:v1")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("keychain failed"))
+			Expect(called).To(BeFalse())
+		})
+
+	})
+
+	It("should parse a retry-after header", func() {
+		now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		Expect(oci.ParseRetryAfter("120", now)).To(Equal(2 * time.Minute))
+		Expect(oci.ParseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now)).To(Equal(time.Minute))
+		Expect(oci.ParseRetryAfter("invalid", now)).To(Equal(time.Duration(0)))
+	})
+
+})
@@ -25,10 +25,13 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"os"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/mandelsoft/vfs/pkg/memoryfs"
+	"github.com/mandelsoft/vfs/pkg/vfs"
 	"github.com/opencontainers/go-digest"
 	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 
@@ -49,6 +52,28 @@ type Client interface {
 
 // OCIRef generates the oci reference from the repository context and a component name and version.
 func OCIRef(repoCtx v2.OCIRegistryRepository, name, version string) (string, error) {
+	repository, err := ociRepository(repoCtx, name)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%s", repository, version), nil
+}
+
+// OCIRefWithDigest generates the oci reference from the repository context and a component name
+// that points to the manifest with the given digest.
+func OCIRefWithDigest(repoCtx v2.OCIRegistryRepository, name string, dgst digest.Digest) (string, error) {
+	if err := dgst.Validate(); err != nil {
+		return "", fmt.Errorf("invalid digest %q: %w", dgst, err)
+	}
+	repository, err := ociRepository(repoCtx, name)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s@%s", repository, dgst.String()), nil
+}
+
+// ociRepository generates the oci repository of a component from the repository context and the component name.
+func ociRepository(repoCtx v2.OCIRegistryRepository, name string) (string, error) {
 	baseUrl := repoCtx.BaseURL
 	if !strings.Contains(baseUrl, "://") {
 		// add dummy protocol to correctly parse the the url
@@ -65,18 +90,27 @@ func OCIRef(repoCtx v2.OCIRegistryRepository, name, version string) (string, err
 
 	switch repoCtx.ComponentNameMapping {
 	case v2.OCIRegistryURLPathMapping, "":
-		ref := path.Join(u.Host, u.Path, ComponentDescriptorNamespace, name)
-		return fmt.Sprintf("%s:%s", ref, version), nil
+		return path.Join(u.Host, u.Path, ComponentDescriptorNamespace, name), nil
 	case v2.OCIRegistryDigestMapping:
 		h := sha256.New()
 		_, _ = h.Write([]byte(name))
-		ref := path.Join(u.Host, u.Path, hex.EncodeToString(h.Sum(nil)))
-		return fmt.Sprintf("%s:%s", ref, version), nil
+		return path.Join(u.Host, u.Path, hex.EncodeToString(h.Sum(nil))), nil
 	default:
 		return "", fmt.Errorf("unknown component name mapping method %s", repoCtx.ComponentNameMapping)
 	}
 }
 
+// ManifestHeadClient is an optional interface of a Client
+// that is able to resolve a reference to the descriptor of its manifest without fetching the manifest,
+// e.g. with a http HEAD request.
+type ManifestHeadClient interface {
+	// HeadManifest returns the ocispec Descriptor of the manifest of a reference.
+	HeadManifest(ctx context.Context, ref string) (ocispecv1.Descriptor, error)
+}
+
+// HeadManifestNotSupportedError defines an error that is returned if a client is not able to resolve manifest descriptors.
+var HeadManifestNotSupportedError = errors.New("HeadManifestNotSupported")
+
 // ItemNotCached defines an error that defines that an item was not cached.
 var ItemNotCached = errors.New("ITEM_NOT_CACHED")
 
@@ -92,13 +126,25 @@ type Cache interface {
 	Store(ctx context.Context, descriptor *v2.ComponentDescriptor) error
 }
 
+// DigestCache is an optional interface of a Cache that caches component descriptors by their manifest digest.
+// It is used instead of the name and version based cache if the resolver pins versions to digests.
+type DigestCache interface {
+	// GetByDigest reads the component descriptor with the given manifest digest from the cache.
+	GetByDigest(ctx context.Context, repoCtx v2.OCIRegistryRepository, name string, dgst digest.Digest) (*v2.ComponentDescriptor, error)
+	// StoreByDigest stores a component descriptor with its manifest digest in the cache.
+	StoreByDigest(ctx context.Context, dgst digest.Digest, descriptor *v2.ComponentDescriptor) error
+}
+
 // Resolver is a generic resolve to resolve a component descriptor from a oci registry.
 // This resolver implements the ctf.ComponentResolver interface.
 type Resolver struct {
-	log        logr.Logger
-	client     Client
-	cache      Cache
-	decodeOpts []codec.DecodeOption
+	log         logr.Logger
+	client      Client
+	cache       Cache
+	decodeOpts  []codec.DecodeOption
+	concurrency int
+	rewrites    RewriteRules
+	pinDigests  bool
 }
 
 // NewResolver creates a new resolver.
@@ -122,6 +168,86 @@ func (r *Resolver) WithLog(log logr.Logger) *Resolver {
 	return r
 }
 
+// WithConcurrency sets the number of workers that are used to fetch the blobs of a component in parallel.
+// A value less or equal to 1 fetches all blobs sequentially, which is the default.
+func (r *Resolver) WithConcurrency(workers int) *Resolver {
+	r.concurrency = workers
+	return r
+}
+
+// WithDigestPinning enables or disables the pinning of versions to manifest digests.
+// If enabled, every version is resolved to the digest of its manifest before the component descriptor is fetched,
+// so that a re-pushed version is detected.
+// The client has to implement the ManifestHeadClient interface.
+// A configured cache is only used if it implements the DigestCache interface.
+// Use ResolveWithDigest to get the digest a component descriptor has been resolved from.
+func (r *Resolver) WithDigestPinning(enabled bool) *Resolver {
+	r.pinDigests = enabled
+	return r
+}
+
+// WithRewriteRules sets the rules that are used to rewrite the base url of oci repository contexts
+// before anything is fetched.
+// The repository context of the resolved component descriptors is not rewritten.
+// The image references of resources with an oci registry access are not rewritten either,
+// use RewriteImageReference or RewriteResources to get the effective references before an image is fetched.
+func (r *Resolver) WithRewriteRules(rules ...RewriteRule) *Resolver {
+	r.rewrites = rules
+	return r
+}
+
+// RewriteImageReference rewrites the given image reference with the configured rewrite rules.
+// It should be used to get the effective reference before an image of a resource is fetched.
+func (r *Resolver) RewriteImageReference(ctx context.Context, ref string) string {
+	return r.rewrite(r.getLogger(ctx), ref)
+}
+
+// rewrite rewrites the reference with the configured rewrite rules and logs the rewrite.
+func (r *Resolver) rewrite(log logr.Logger, ref string) string {
+	rewritten, ok := r.rewrites.Rewrite(ref)
+	if ok {
+		log.V(3).Info("rewrite reference", "from", ref, "to", rewritten)
+	}
+	return rewritten
+}
+
+// RewriteResources returns a copy of the component descriptor with the image references
+// of all resources with an oci registry access rewritten with the configured rewrite rules.
+// The given component descriptor is not modified.
+func (r *Resolver) RewriteResources(ctx context.Context, cd *v2.ComponentDescriptor) (*v2.ComponentDescriptor, error) {
+	cd = cd.DeepCopy()
+	log := r.getLogger(ctx)
+	for i, res := range cd.Resources {
+		if res.Access == nil || res.Access.GetType() != v2.OCIRegistryType {
+			continue
+		}
+		access := &v2.OCIRegistryAccess{}
+		if err := res.Access.DecodeInto(access); err != nil {
+			return nil, fmt.Errorf("unable to decode access of resource %s: %w", res.GetName(), err)
+		}
+		rewritten := r.rewrite(log, access.ImageReference)
+		if rewritten == access.ImageReference {
+			continue
+		}
+		// the access is copied with all of its fields so that unknown attributes are kept.
+		obj := make(map[string]interface{}, len(res.Access.Object))
+		for k, v := range res.Access.Object {
+			obj[k] = v
+		}
+		obj["imageReference"] = rewritten
+		raw, err := json.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode access of resource %s: %w", res.GetName(), err)
+		}
+		rewrittenAccess := &v2.UnstructuredTypedObject{}
+		if err := rewrittenAccess.UnmarshalJSON(raw); err != nil {
+			return nil, fmt.Errorf("unable to decode rewritten access of resource %s: %w", res.GetName(), err)
+		}
+		cd.Resources[i].Access = rewrittenAccess
+	}
+	return cd, nil
+}
+
 // Resolve resolves a component descriptor by name and version within the configured context.
 func (r *Resolver) Resolve(ctx context.Context, repoCtx v2.Repository, name, version string) (*v2.ComponentDescriptor, error) {
 	cd, _, err := r.resolve(ctx, repoCtx, name, version, false)
@@ -134,27 +260,67 @@ func (r *Resolver) ResolveWithBlobResolver(ctx context.Context, repoCtx v2.Repos
 	return r.resolve(ctx, repoCtx, name, version, true)
 }
 
+// ResolveWithDigest pins the version of a component to the digest of its manifest
+// and resolves the component descriptor of that manifest within the configured context.
+// The digest is returned together with the component descriptor and a blob resolver to access the local artifacts,
+// so that the digest is always the one the component descriptor has been resolved from.
+// The version is pinned regardless of whether digest pinning is enabled for the resolver.
+func (r *Resolver) ResolveWithDigest(ctx context.Context, repoCtx v2.Repository, name, version string) (*v2.ComponentDescriptor, ctf.BlobResolver, digest.Digest, error) {
+	repo, err := decodeOCIRegistryRepository(repoCtx)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	log := r.getLogger(ctx).WithValues("repoCtxType", repoCtx.GetType(), "baseUrl", repo.BaseURL, "name", name, "version", version)
+	fetchRepo := repo
+	fetchRepo.BaseURL = r.rewrite(log, repo.BaseURL)
+	return r.resolvePinned(ctx, log, repo, fetchRepo, name, version, true)
+}
+
+// ResolveManifestDigest resolves the version of a component to the digest of its manifest.
+// The client has to implement the ManifestHeadClient interface.
+func (r *Resolver) ResolveManifestDigest(ctx context.Context, repoCtx v2.Repository, name, version string) (digest.Digest, error) {
+	repo, err := decodeOCIRegistryRepository(repoCtx)
+	if err != nil {
+		return "", err
+	}
+	log := r.getLogger(ctx).WithValues("repoCtxType", repoCtx.GetType(), "baseUrl", repo.BaseURL, "name", name, "version", version)
+	fetchRepo := repo
+	fetchRepo.BaseURL = r.rewrite(log, repo.BaseURL)
+	return r.headManifest(ctx, fetchRepo, name, version)
+}
+
+// ResolveByDigest resolves a component descriptor by name and the digest of its manifest within the configured context.
+func (r *Resolver) ResolveByDigest(ctx context.Context, repoCtx v2.Repository, name string, dgst digest.Digest) (*v2.ComponentDescriptor, error) {
+	cd, _, err := r.resolveByDigest(ctx, repoCtx, name, dgst, false)
+	return cd, err
+}
+
+// ResolveByDigestWithBlobResolver resolves a component descriptor by name and the digest of its manifest within the configured context.
+// And it also returns a blob resolver to access the local artifacts.
+func (r *Resolver) ResolveByDigestWithBlobResolver(ctx context.Context, repoCtx v2.Repository, name string, dgst digest.Digest) (*v2.ComponentDescriptor, ctf.BlobResolver, error) {
+	return r.resolveByDigest(ctx, repoCtx, name, dgst, true)
+}
+
 // resolve resolves a component descriptor by name and version within the configured context.
 // If withBlobResolver is false the returned blobresolver is always nil
 func (r *Resolver) resolve(ctx context.Context, repoCtx v2.Repository, name, version string, withBlobResolver bool) (*v2.ComponentDescriptor, ctf.BlobResolver, error) {
-	var repo v2.OCIRegistryRepository
-	switch r := repoCtx.(type) {
-	case *v2.UnstructuredTypedObject:
-		if err := r.DecodeInto(&repo); err != nil {
-			return nil, nil, err
-		}
-	case *v2.OCIRegistryRepository:
-		repo = *r
-	default:
-		return nil, nil, fmt.Errorf("unknown repository context type %s", repoCtx.GetType())
+	repo, err := decodeOCIRegistryRepository(repoCtx)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// setup logger
-	log, err := logr.FromContext(ctx)
-	if err != nil {
-		log = r.log
+	log := r.getLogger(ctx).WithValues("repoCtxType", repoCtx.GetType(), "baseUrl", repo.BaseURL, "name", name, "version", version)
+
+	// the repository is only rewritten to fetch the artifacts,
+	// the component descriptor keeps the original repository context.
+	fetchRepo := repo
+	fetchRepo.BaseURL = r.rewrite(log, repo.BaseURL)
+
+	if r.pinDigests {
+		cd, blobResolver, _, err := r.resolvePinned(ctx, log, repo, fetchRepo, name, version, withBlobResolver)
+		return cd, blobResolver, err
 	}
-	log = log.WithValues("repoCtxType", repoCtx.GetType(), "baseUrl", repo.BaseURL, "name", name, "version", version)
 
 	if r.cache != nil {
 		cd, err := r.cache.Get(ctx, repo, name, version)
@@ -166,7 +332,7 @@ func (r *Resolver) resolve(ctx context.Context, repoCtx v2.Repository, name, ver
 			}
 		} else {
 			if withBlobResolver {
-				manifest, ref, err := r.fetchManifest(ctx, repo, name, version)
+				manifest, ref, err := r.fetchManifest(ctx, fetchRepo, name, version)
 				if err != nil {
 					return nil, nil, err
 				}
@@ -176,48 +342,108 @@ func (r *Resolver) resolve(ctx context.Context, repoCtx v2.Repository, name, ver
 		}
 	}
 
-	manifest, ref, err := r.fetchManifest(ctx, repo, name, version)
+	manifest, ref, err := r.fetchManifest(ctx, fetchRepo, name, version)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	componentConfig, err := r.getComponentConfig(ctx, ref, manifest)
+	cd, err := r.fetchComponentDescriptor(ctx, ref, manifest)
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := v2.InjectRepositoryContext(cd, &repo); err != nil {
+		return nil, nil, err
+	}
 
-	componentDescriptorLayer := GetLayerWithDigest(manifest.Layers, componentConfig.ComponentDescriptorLayer.Digest)
-	if componentDescriptorLayer == nil {
-		return nil, nil, fmt.Errorf("no component descriptor layer defined")
+	if r.cache != nil {
+		if err := r.cache.Store(ctx, cd.DeepCopy()); err != nil {
+			log.Error(err, "unable to store component descriptor")
+		}
 	}
 
-	var componentDescriptorLayerBytes bytes.Buffer
-	if err := r.client.Fetch(ctx, ref, *componentDescriptorLayer, &componentDescriptorLayerBytes); err != nil {
-		return nil, nil, fmt.Errorf("unable to fetch component descriptor layer: %w", err)
+	if withBlobResolver {
+		return cd, NewBlobResolver(r.client, ref, manifest, cd), nil
 	}
+	return cd, nil, nil
+}
 
-	componentDescriptorBytes := componentDescriptorLayerBytes.Bytes()
-	switch componentDescriptorLayer.MediaType {
-	case ComponentDescriptorTarMimeTypeOCM, ComponentDescriptorTarMimeType, LegacyComponentDescriptorTarMimeType:
-		componentDescriptorBytes, err = ReadComponentDescriptorFromTar(&componentDescriptorLayerBytes)
+// resolvePinned resolves the version to the digest of its manifest and fetches the component descriptor with that digest.
+// The pinned digest is returned with the component descriptor.
+func (r *Resolver) resolvePinned(ctx context.Context, log logr.Logger, repo, fetchRepo v2.OCIRegistryRepository, name, version string, withBlobResolver bool) (*v2.ComponentDescriptor, ctf.BlobResolver, digest.Digest, error) {
+	dgst, err := r.headManifest(ctx, fetchRepo, name, version)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	log.V(5).Info("pinned version to manifest digest", "digest", dgst.String())
+	cd, blobResolver, err := r.resolveDigest(ctx, log, repo, fetchRepo, name, dgst, withBlobResolver)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return cd, blobResolver, dgst, nil
+}
+
+// resolveByDigest resolves a component descriptor by name and manifest digest within the configured context.
+// If withBlobResolver is false the returned blobresolver is always nil
+func (r *Resolver) resolveByDigest(ctx context.Context, repoCtx v2.Repository, name string, dgst digest.Digest, withBlobResolver bool) (*v2.ComponentDescriptor, ctf.BlobResolver, error) {
+	repo, err := decodeOCIRegistryRepository(repoCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+	log := r.getLogger(ctx).WithValues("repoCtxType", repoCtx.GetType(), "baseUrl", repo.BaseURL, "name", name, "digest", dgst.String())
+	fetchRepo := repo
+	fetchRepo.BaseURL = r.rewrite(log, repo.BaseURL)
+	return r.resolveDigest(ctx, log, repo, fetchRepo, name, dgst, withBlobResolver)
+}
+
+// resolveDigest fetches the component descriptor with the given manifest digest from the fetch repository.
+// A configured cache that does not implement the DigestCache interface is skipped.
+func (r *Resolver) resolveDigest(ctx context.Context, log logr.Logger, repo, fetchRepo v2.OCIRegistryRepository, name string, dgst digest.Digest, withBlobResolver bool) (*v2.ComponentDescriptor, ctf.BlobResolver, error) {
+	if err := checkRepositoryType(fetchRepo); err != nil {
+		return nil, nil, err
+	}
+	cache, hasCache := r.cache.(DigestCache)
+	if r.cache != nil && !hasCache {
+		log.V(3).Info("skip cache that does not support digests")
+	}
+	ref, err := OCIRefWithDigest(fetchRepo, name, dgst)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to generate oci reference: %w", err)
+	}
+
+	if hasCache {
+		cd, err := cache.GetByDigest(ctx, repo, name, dgst)
 		if err != nil {
-			return nil, nil, fmt.Errorf("unable to read component descriptor from tar: %w", err)
+			if errors.Is(err, ctf.NotFoundError) {
+				log.V(5).Info(err.Error())
+			} else {
+				log.Error(err, "unable to get component descriptor")
+			}
+		} else {
+			if withBlobResolver {
+				manifest, err := r.getManifest(ctx, ref)
+				if err != nil {
+					return nil, nil, err
+				}
+				return cd, NewBlobResolver(r.client, ref, manifest, cd), nil
+			}
+			return cd, nil, nil
 		}
-	case ComponentDescriptorJSONMimeType:
-	default:
-		return nil, nil, fmt.Errorf("unsupported media type %q", componentDescriptorLayer.MediaType)
 	}
 
-	cd := &v2.ComponentDescriptor{}
-	if err := codec.Decode(componentDescriptorBytes, cd, r.decodeOpts...); err != nil {
-		return nil, nil, fmt.Errorf("unable to decode component descriptor: %w", err)
+	manifest, err := r.getManifest(ctx, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	cd, err := r.fetchComponentDescriptor(ctx, ref, manifest)
+	if err != nil {
+		return nil, nil, err
 	}
 	if err := v2.InjectRepositoryContext(cd, &repo); err != nil {
 		return nil, nil, err
 	}
 
-	if r.cache != nil {
-		if err := r.cache.Store(ctx, cd.DeepCopy()); err != nil {
+	if hasCache {
+		if err := cache.StoreByDigest(ctx, dgst, cd.DeepCopy()); err != nil {
 			log.Error(err, "unable to store component descriptor")
 		}
 	}
@@ -228,32 +454,148 @@ func (r *Resolver) resolve(ctx context.Context, repoCtx v2.Repository, name, ver
 	return cd, nil, nil
 }
 
+// fetchComponentDescriptor fetches and decodes the component descriptor that is described by the given manifest.
+func (r *Resolver) fetchComponentDescriptor(ctx context.Context, ref string, manifest *ocispecv1.Manifest) (*v2.ComponentDescriptor, error) {
+	componentConfig, err := r.getComponentConfig(ctx, ref, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	componentDescriptorLayer := GetLayerWithDigest(manifest.Layers, componentConfig.ComponentDescriptorLayer.Digest)
+	if componentDescriptorLayer == nil {
+		return nil, fmt.Errorf("no component descriptor layer defined")
+	}
+
+	var componentDescriptorLayerBytes bytes.Buffer
+	if err := FetchAndVerify(ctx, r.client, ref, *componentDescriptorLayer, &componentDescriptorLayerBytes); err != nil {
+		return nil, fmt.Errorf("unable to fetch component descriptor layer: %w", err)
+	}
+
+	componentDescriptorBytes := componentDescriptorLayerBytes.Bytes()
+	switch componentDescriptorLayer.MediaType {
+	case ComponentDescriptorTarMimeTypeOCM, ComponentDescriptorTarMimeType, LegacyComponentDescriptorTarMimeType:
+		componentDescriptorBytes, err = ReadComponentDescriptorFromTar(&componentDescriptorLayerBytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read component descriptor from tar: %w", err)
+		}
+	case ComponentDescriptorJSONMimeType:
+	default:
+		return nil, fmt.Errorf("unsupported media type %q", componentDescriptorLayer.MediaType)
+	}
+
+	cd := &v2.ComponentDescriptor{}
+	if err := codec.Decode(componentDescriptorBytes, cd, r.decodeOpts...); err != nil {
+		return nil, fmt.Errorf("unable to decode component descriptor: %w", err)
+	}
+	return cd, nil
+}
+
 // fetchManifest fetches the oci manifest.
 // The manifest and the oci ref is returned.
 func (r *Resolver) fetchManifest(ctx context.Context, repoCtx v2.OCIRegistryRepository, name, version string) (*ocispecv1.Manifest, string, error) {
-	if repoCtx.Type != v2.OCIRegistryType {
-		return nil, "", fmt.Errorf("unsupported type %s expected %s", repoCtx.Type, v2.OCIRegistryType)
+	if err := checkRepositoryType(repoCtx); err != nil {
+		return nil, "", err
 	}
 	ref, err := OCIRef(repoCtx, name, version)
 	if err != nil {
 		return nil, "", fmt.Errorf("unable to generate oci reference: %w", err)
 	}
 
-	manifest, err := r.client.GetManifest(ctx, ref)
+	manifest, err := r.getManifest(ctx, ref)
 	if err != nil {
-		return nil, "", fmt.Errorf("unable to fetch manifest from ref %s: %w", ref, err)
+		return nil, "", err
 	}
 	return manifest, ref, nil
 }
 
+// getManifest fetches the oci manifest of a reference.
+func (r *Resolver) getManifest(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+	manifest, err := r.client.GetManifest(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch manifest from ref %s: %w", ref, err)
+	}
+	return manifest, nil
+}
+
+// headManifest resolves the version of a component to the digest of its manifest.
+func (r *Resolver) headManifest(ctx context.Context, repoCtx v2.OCIRegistryRepository, name, version string) (digest.Digest, error) {
+	if err := checkRepositoryType(repoCtx); err != nil {
+		return "", err
+	}
+	ref, err := OCIRef(repoCtx, name, version)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate oci reference: %w", err)
+	}
+	desc, err := headManifest(ctx, r.client, ref)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve manifest digest of ref %s: %w", ref, err)
+	}
+	if err := desc.Digest.Validate(); err != nil {
+		return "", fmt.Errorf("invalid manifest digest %q for ref %s: %w", desc.Digest, ref, err)
+	}
+	return desc.Digest, nil
+}
+
+// getLogger returns the logger of the context or the configured logger of the resolver.
+func (r *Resolver) getLogger(ctx context.Context) logr.Logger {
+	log, err := logr.FromContext(ctx)
+	if err != nil {
+		return r.log
+	}
+	return log
+}
+
+// decodeOCIRegistryRepository decodes a repository context into a oci registry repository.
+func decodeOCIRegistryRepository(repoCtx v2.Repository) (v2.OCIRegistryRepository, error) {
+	var repo v2.OCIRegistryRepository
+	switch r := repoCtx.(type) {
+	case *v2.UnstructuredTypedObject:
+		if err := r.DecodeInto(&repo); err != nil {
+			return repo, err
+		}
+	case *v2.OCIRegistryRepository:
+		repo = *r
+	default:
+		return repo, fmt.Errorf("unknown repository context type %s", repoCtx.GetType())
+	}
+	return repo, nil
+}
+
+// checkRepositoryType checks whether the repository is a oci registry repository.
+func checkRepositoryType(repoCtx v2.OCIRegistryRepository) error {
+	if repoCtx.Type != v2.OCIRegistryType {
+		return fmt.Errorf("unsupported type %s expected %s", repoCtx.Type, v2.OCIRegistryType)
+	}
+	return nil
+}
+
 // ToComponentArchive creates a tar archive in the CTF (Cnudie Transport Format) from the given component descriptor.
+// The blobs of the resources are fetched in parallel if a concurrency greater than 1 is configured.
+// The resulting archive is the same regardless of the configured concurrency.
+// Sources that are stored as oci blobs are added to the archive, too.
 func (r *Resolver) ToComponentArchive(ctx context.Context, repoCtx v2.Repository, name, version string, writer io.Writer) error {
 	cd, blobresolver, err := r.ResolveWithBlobResolver(ctx, repoCtx, name, version)
 	if err != nil {
 		return err
 	}
 
-	ca := ctf.NewComponentArchive(cd, memoryfs.New())
+	fs := memoryfs.New()
+	ca := ctf.NewComponentArchive(cd, fs)
+	for _, src := range cd.Sources {
+		if err := ca.AddSourceFromResolver(ctx, &src, blobresolver); err != nil {
+			if errors.Is(err, ctf.UnsupportedResolveType) {
+				continue
+			}
+			return fmt.Errorf("unable to add source %s to archive: %w", src.GetName(), err)
+		}
+	}
+	if r.concurrency > 1 {
+		// the blobs are prefetched to the blob directory of the archive,
+		// so that they are not fetched again when the resources are added.
+		if err := r.prefetchBlobs(ctx, fs, cd.Resources, blobresolver); err != nil {
+			return err
+		}
+	}
 	for _, res := range cd.Resources {
 		if err := ca.AddResourceFromResolver(ctx, &res, blobresolver); err != nil {
 			return fmt.Errorf("unable to add resource %s to archive: %w", res.GetName(), err)
@@ -262,6 +604,91 @@ func (r *Resolver) ToComponentArchive(ctx context.Context, repoCtx v2.Repository
 	return ca.WriteTar(writer)
 }
 
+// prefetchBlobs fetches the blobs of all given resources with the configured number of workers
+// and writes them to the blob directory of the archive filesystem.
+// Every blob is written to a temporary file and only moved to its blob path when it has been completely fetched.
+// The fetch of all remaining blobs is canceled as soon as the first error occurs.
+func (r *Resolver) prefetchBlobs(ctx context.Context, fs vfs.FileSystem, resources []v2.Resource, blobresolver ctf.BlobResolver) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := fs.MkdirAll(ctf.BlobsDirectoryName, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create blob directory: %w", err)
+	}
+
+	var (
+		indexes  = make(chan int)
+		wg       sync.WaitGroup
+		fsMux    sync.Mutex
+		errOnce  sync.Once
+		firstErr error
+	)
+	for w := 0; w < r.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				res := resources[i]
+				if err := prefetchBlob(ctx, fs, &fsMux, ctf.BlobPath(fmt.Sprintf(".prefetch-%d", i)), res, blobresolver); err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("unable to fetch blob of resource %s: %w", res.GetName(), err)
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	for i := range resources {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// prefetchBlob fetches the blob of the resource to the temporary path and moves it to its blob path.
+// Changes of the directory structure of the filesystem are synchronized with the given mutex.
+func prefetchBlob(ctx context.Context, fs vfs.FileSystem, fsMux *sync.Mutex, tempPath string, res v2.Resource, blobresolver ctf.BlobResolver) error {
+	info, err := blobresolver.Info(ctx, res)
+	if err != nil {
+		return err
+	}
+	fsMux.Lock()
+	file, err := fs.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	fsMux.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = blobresolver.Resolve(ctx, res, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	fsMux.Lock()
+	defer fsMux.Unlock()
+	if err != nil {
+		_ = fs.Remove(tempPath)
+		return err
+	}
+	blobpath := ctf.BlobPath(info.Digest)
+	if exists, err := vfs.FileExists(fs, blobpath); err != nil || exists {
+		// the same blob is used by multiple resources.
+		_ = fs.Remove(tempPath)
+		return err
+	}
+	return fs.Rename(tempPath, blobpath)
+}
+
 func (r *Resolver) getComponentConfig(ctx context.Context, ref string, manifest *ocispecv1.Manifest) (*ComponentDescriptorConfig, error) {
 	if manifest.Config.MediaType != ComponentDescriptorConfigMimeType &&
 		manifest.Config.MediaType != ComponentDescriptorLegacyConfigMimeType && manifest.Config.MediaType != ComponentDescriptorConfigMimeTypeOCM {
@@ -269,7 +696,7 @@ func (r *Resolver) getComponentConfig(ctx context.Context, ref string, manifest
 	}
 
 	var data bytes.Buffer
-	if err := r.client.Fetch(ctx, ref, manifest.Config, &data); err != nil {
+	if err := FetchAndVerify(ctx, r.client, ref, manifest.Config, &data); err != nil {
 		return nil, fmt.Errorf("unable to resolve component config: %w", err)
 	}
 
@@ -312,6 +739,26 @@ func (b *blobResolver) Resolve(ctx context.Context, res v2.Resource, writer io.W
 	return b.resolve(ctx, res, writer)
 }
 
+// InfoSource returns the blob info of a source that is stored as oci blob.
+func (b *blobResolver) InfoSource(ctx context.Context, src v2.Source) (*ctf.BlobInfo, error) {
+	return b.resolveSource(ctx, src, nil)
+}
+
+// ResolveSource fetches the blob of a source that is stored as oci blob.
+func (b *blobResolver) ResolveSource(ctx context.Context, src v2.Source, writer io.Writer) (*ctf.BlobInfo, error) {
+	return b.resolveSource(ctx, src, writer)
+}
+
+func (b *blobResolver) resolveSource(ctx context.Context, src v2.Source, writer io.Writer) (*ctf.BlobInfo, error) {
+	if src.Access == nil || (src.Access.GetType() != v2.LocalOCIBlobType && src.Access.GetType() != v2.OCIBlobType) {
+		return nil, ctf.UnsupportedResolveType
+	}
+	return b.resolve(ctx, v2.Resource{
+		IdentityObjectMeta: src.IdentityObjectMeta,
+		Access:             src.Access,
+	}, writer)
+}
+
 func (b *blobResolver) resolve(ctx context.Context, res v2.Resource, writer io.Writer) (*ctf.BlobInfo, error) {
 	switch res.Access.GetType() {
 	case v2.LocalOCIBlobType:
@@ -326,7 +773,7 @@ func (b *blobResolver) resolve(ctx context.Context, res v2.Resource, writer io.W
 		}
 
 		if writer != nil {
-			if err := b.client.Fetch(ctx, b.ref, *blobLayer, writer); err != nil {
+			if err := FetchAndVerify(ctx, b.client, b.ref, *blobLayer, writer); err != nil {
 				return nil, err
 			}
 		}
@@ -343,7 +790,7 @@ func (b *blobResolver) resolve(ctx context.Context, res v2.Resource, writer io.W
 		}
 
 		if writer != nil {
-			if err := b.client.Fetch(ctx, b.ref, ocispecv1.Descriptor{
+			if err := FetchAndVerify(ctx, b.client, b.ref, ocispecv1.Descriptor{
 				MediaType: ociBlobAccess.MediaType,
 				Digest:    digest.Digest(ociBlobAccess.Digest),
 				Size:      ociBlobAccess.Size,
@@ -5,19 +5,24 @@
 package oci_test
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"sync"
 
 	"github.com/gardener/component-spec/bindings-go/codec"
+	"github.com/mandelsoft/vfs/pkg/memoryfs"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/opencontainers/go-digest"
 	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 
 	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/ctf"
 	"github.com/gardener/component-spec/bindings-go/oci"
 )
 
@@ -27,45 +32,7 @@ var _ = Describe("resolve", func(){
 
 		It("should fetch a component descriptor", func() {
 			ctx := context.Background()
-			ociClient := &testClient{
-				getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
-					return &ocispecv1.Manifest{
-						Config: ocispecv1.Descriptor{
-							MediaType: oci.ComponentDescriptorConfigMimeType,
-							Digest: digest.FromString("config"),
-						},
-						Layers: []ocispecv1.Descriptor{
-							{
-								MediaType: oci.ComponentDescriptorJSONMimeType,
-								Digest: digest.FromString("cd"),
-							},
-						},
-					}, nil
-				},
-				fetch: func(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
-					switch desc.Digest.String() {
-					case digest.FromString("config").String():
-						config := oci.ComponentDescriptorConfig{
-							ComponentDescriptorLayer: &oci.OciBlobRef{
-								MediaType: oci.ComponentDescriptorConfigMimeType,
-								Digest: digest.FromString("cd").String(),
-							},
-						}
-						return json.NewEncoder(writer).Encode(config)
-					case digest.FromString("cd").String():
-						data, err := codec.Encode(defaultComponentDescriptor("example.com/my-comp", "0.0.0"))
-						if err != nil {
-							return err
-						}
-						if _, err := io.Copy(writer, bytes.NewBuffer(data)); err != nil {
-							return err
-						}
-						return nil
-					default:
-						return errors.New("unknown desc")
-					}
-				},
-			}
+			ociClient := newComponentTestClient(defaultComponentDescriptor("example.com/my-comp", "0.0.0"), nil, nil)
 			cd, err := oci.NewResolver(ociClient).Resolve(ctx, cdv2.NewOCIRegistryRepository("example.com", ""), "example.com/my-comp", "0.0.0")
 			Expect(err).ToNot(HaveOccurred())
 			repoCtx := &cdv2.OCIRegistryRepository{}
@@ -111,45 +78,7 @@ var _ = Describe("resolve", func(){
 					return nil
 				},
 			}
-			ociClient := &testClient{
-				getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
-					return &ocispecv1.Manifest{
-						Config: ocispecv1.Descriptor{
-							MediaType: oci.ComponentDescriptorConfigMimeType,
-							Digest: digest.FromString("config"),
-						},
-						Layers: []ocispecv1.Descriptor{
-							{
-								MediaType: oci.ComponentDescriptorJSONMimeType,
-								Digest: digest.FromString("cd"),
-							},
-						},
-					}, nil
-				},
-				fetch: func(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
-					switch desc.Digest.String() {
-					case digest.FromString("config").String():
-						config := oci.ComponentDescriptorConfig{
-							ComponentDescriptorLayer: &oci.OciBlobRef{
-								MediaType: oci.ComponentDescriptorConfigMimeType,
-								Digest: digest.FromString("cd").String(),
-							},
-						}
-						return json.NewEncoder(writer).Encode(config)
-					case digest.FromString("cd").String():
-						data, err := codec.Encode(defaultComponentDescriptor("example.com/my-comp", "0.0.0"))
-						if err != nil {
-							return err
-						}
-						if _, err := io.Copy(writer, bytes.NewBuffer(data)); err != nil {
-							return err
-						}
-						return nil
-					default:
-						return errors.New("unknown desc")
-					}
-				},
-			}
+			ociClient := newComponentTestClient(defaultComponentDescriptor("example.com/my-comp", "0.0.0"), nil, nil)
 			cd, err := oci.NewResolver(ociClient).WithCache(ociCache).Resolve(ctx, cdv2.NewOCIRegistryRepository("example.com", ""), "example.com/my-comp", "0.0.0")
 			Expect(err).ToNot(HaveOccurred())
 
@@ -161,8 +90,242 @@ var _ = Describe("resolve", func(){
 
 	})
 
+	Context("ToComponentArchive", func() {
+
+		It("should create the same archive with parallel and sequential blob fetching", func() {
+			ctx := context.Background()
+			cd, blobs := newBlobComponentDescriptor("example.com/my-comp", "0.0.0", 10)
+			ociClient := newComponentTestClient(cd, blobs, nil)
+
+			var sequential bytes.Buffer
+			Expect(oci.NewResolver(ociClient).ToComponentArchive(ctx, cdv2.NewOCIRegistryRepository("example.com", ""), "example.com/my-comp", "0.0.0", &sequential)).To(Succeed())
+			var parallel bytes.Buffer
+			Expect(oci.NewResolver(ociClient).WithConcurrency(4).ToComponentArchive(ctx, cdv2.NewOCIRegistryRepository("example.com", ""), "example.com/my-comp", "0.0.0", &parallel)).To(Succeed())
+
+			seqNames, seqEntries := readTarEntries(sequential.Bytes())
+			parNames, parEntries := readTarEntries(parallel.Bytes())
+			Expect(parNames).To(Equal(seqNames))
+			Expect(parEntries).To(Equal(seqEntries))
+
+			parCa, err := ctf.NewComponentArchiveFromTarReader(bytes.NewReader(parallel.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parCa.ComponentDescriptor.Resources).To(HaveLen(10))
+			for i, res := range parCa.ComponentDescriptor.Resources {
+				var data bytes.Buffer
+				info, err := parCa.Resolve(ctx, res, &data)
+				Expect(err).ToNot(HaveOccurred())
+				expected := blobs[cd.Resources[i].Access.Object["digest"].(string)]
+				Expect(data.Bytes()).To(Equal(expected), "blob of resource %s", res.GetName())
+				Expect(info.Size).To(Equal(int64(len(expected))))
+			}
+		})
+
+		It("should fetch every blob only once and handle shared blobs with parallel blob fetching", func() {
+			ctx := context.Background()
+			cd, blobs := newBlobComponentDescriptor("example.com/my-comp", "0.0.0", 4)
+			shared := cd.Resources[0].DeepCopy()
+			shared.Name = "res-shared"
+			cd.Resources = append(cd.Resources, *shared)
+
+			var mux sync.Mutex
+			fetched := map[string]int{}
+			ociClient := newComponentTestClient(cd, blobs, func(desc ocispecv1.Descriptor) error {
+				mux.Lock()
+				defer mux.Unlock()
+				fetched[desc.Digest.String()]++
+				return nil
+			})
+
+			var archive bytes.Buffer
+			Expect(oci.NewResolver(ociClient).WithConcurrency(4).ToComponentArchive(ctx, cdv2.NewOCIRegistryRepository("example.com", ""), "example.com/my-comp", "0.0.0", &archive)).To(Succeed())
+			for _, res := range cd.Resources[1:4] {
+				Expect(fetched[res.Access.Object["digest"].(string)]).To(Equal(1), "blob of resource %s", res.GetName())
+			}
+
+			ca, err := ctf.NewComponentArchiveFromTarReader(bytes.NewReader(archive.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ca.ComponentDescriptor.Resources).To(HaveLen(5))
+			var data bytes.Buffer
+			_, err = ca.Resolve(ctx, ca.ComponentDescriptor.Resources[4], &data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data.Bytes()).To(Equal(blobs[shared.Access.Object["digest"].(string)]))
+		})
+
+		It("should return the first error that occurs while fetching blobs in parallel", func() {
+			ctx := context.Background()
+			cd, blobs := newBlobComponentDescriptor("example.com/my-comp", "0.0.0", 5)
+			failing := cd.Resources[2].Access.Object["digest"].(string)
+			ociClient := newComponentTestClient(cd, blobs, func(desc ocispecv1.Descriptor) error {
+				if desc.Digest.String() == failing {
+					return errors.New("fetch failed")
+				}
+				return nil
+			})
+
+			var data bytes.Buffer
+			err := oci.NewResolver(ociClient).WithConcurrency(3).ToComponentArchive(ctx, cdv2.NewOCIRegistryRepository("example.com", ""), "example.com/my-comp", "0.0.0", &data)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("res-2"))
+			Expect(err.Error()).To(ContainSubstring("fetch failed"))
+		})
+
+		It("should upload source blobs and add them to the component archive", func() {
+			ctx := context.Background()
+			ca := ctf.NewComponentArchive(defaultComponentDescriptor("example.com/my-comp", "0.0.0"), memoryfs.New())
+			data := []byte("source blob")
+			Expect(ca.AddSource(&cdv2.Source{
+				IdentityObjectMeta: cdv2.IdentityObjectMeta{
+					Name:    "src",
+					Version: "0.0.0",
+					Type:    "git",
+				},
+			}, ctf.BlobInfo{
+				MediaType: "application/x-tar",
+				Digest:    digest.FromBytes(data).String(),
+				Size:      int64(len(data)),
+			}, bytes.NewBuffer(data))).To(Succeed())
+
+			store := memoryBlobStore{}
+			manifest, err := oci.NewManifestBuilder(store, ca).Build(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manifest.Layers).To(HaveLen(2))
+			Expect(store[digest.FromBytes(data).String()]).To(Equal(data))
+			Expect(ca.ComponentDescriptor.Sources[0].Access.GetType()).To(Equal(cdv2.LocalOCIBlobType))
+
+			ociClient := newComponentTestClient(ca.ComponentDescriptor, map[string][]byte{digest.FromBytes(data).String(): data}, nil)
+			var archive bytes.Buffer
+			Expect(oci.NewResolver(ociClient).ToComponentArchive(ctx, cdv2.NewOCIRegistryRepository("example.com", ""), "example.com/my-comp", "0.0.0", &archive)).To(Succeed())
+			result, err := ctf.NewComponentArchiveFromTarReader(&archive)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.ComponentDescriptor.Sources[0].Access.GetType()).To(Equal(cdv2.LocalFilesystemBlobType))
+			var blob bytes.Buffer
+			_, err = result.ResolveSource(ctx, result.ComponentDescriptor.Sources[0], &blob)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(blob.Bytes()).To(Equal(data))
+		})
+
+	})
+
 })
 
+// newComponentTestClient creates a test client that serves the given component descriptor
+// with the given blobs as layers of its manifest.
+// The optional fetchHook is called before a blob is fetched and can be used to inject errors.
+func newComponentTestClient(cd *cdv2.ComponentDescriptor, blobs map[string][]byte, fetchHook func(desc ocispecv1.Descriptor) error) *testClient {
+	cdData, err := codec.Encode(cd)
+	Expect(err).ToNot(HaveOccurred())
+	cdDesc := ocispecv1.Descriptor{
+		MediaType: oci.ComponentDescriptorJSONMimeType,
+		Digest:    digest.FromBytes(cdData),
+		Size:      int64(len(cdData)),
+	}
+	configData, err := json.Marshal(oci.ComponentDescriptorConfig{
+		ComponentDescriptorLayer: &oci.OciBlobRef{
+			MediaType: cdDesc.MediaType,
+			Digest:    cdDesc.Digest.String(),
+			Size:      cdDesc.Size,
+		},
+	})
+	Expect(err).ToNot(HaveOccurred())
+	configDesc := ocispecv1.Descriptor{
+		MediaType: oci.ComponentDescriptorConfigMimeType,
+		Digest:    digest.FromBytes(configData),
+		Size:      int64(len(configData)),
+	}
+
+	data := map[string][]byte{
+		cdDesc.Digest.String():     cdData,
+		configDesc.Digest.String(): configData,
+	}
+	layers := []ocispecv1.Descriptor{cdDesc}
+	for dig, blob := range blobs {
+		data[dig] = blob
+		layers = append(layers, ocispecv1.Descriptor{
+			MediaType: "application/octet-stream",
+			Digest:    digest.Digest(dig),
+			Size:      int64(len(blob)),
+		})
+	}
+
+	return &testClient{
+		getManifest: func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+			return &ocispecv1.Manifest{
+				Config: configDesc,
+				Layers: layers,
+			}, nil
+		},
+		fetch: func(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+			if fetchHook != nil {
+				if err := fetchHook(desc); err != nil {
+					return err
+				}
+			}
+			blob, ok := data[desc.Digest.String()]
+			if !ok {
+				return errors.New("unknown desc")
+			}
+			_, err := io.Copy(writer, bytes.NewBuffer(blob))
+			return err
+		},
+	}
+}
+
+// newBlobComponentDescriptor creates a component descriptor with the given number of resources
+// that are stored as local oci blobs.
+// The blobs have different sizes and are returned by their digest.
+func newBlobComponentDescriptor(name, version string, resources int) (*cdv2.ComponentDescriptor, map[string][]byte) {
+	blobs := map[string][]byte{}
+	cd := defaultComponentDescriptor(name, version)
+	for i := 0; i < resources; i++ {
+		data := bytes.Repeat([]byte(fmt.Sprintf("blob-%d;", i)), (i+1)*512)
+		dig := digest.FromBytes(data)
+		blobs[dig.String()] = data
+		acc, err := cdv2.NewUnstructured(cdv2.NewLocalOCIBlobAccess(dig.String()))
+		Expect(err).ToNot(HaveOccurred())
+		cd.Resources = append(cd.Resources, cdv2.Resource{
+			IdentityObjectMeta: cdv2.IdentityObjectMeta{
+				Name:    fmt.Sprintf("res-%d", i),
+				Version: version,
+				Type:    "blob",
+			},
+			Relation: cdv2.LocalRelation,
+			Access:   &acc,
+		})
+	}
+	return cd, blobs
+}
+
+// readTarEntries returns the names of all entries of a tar in their order and the content of the entries by name.
+func readTarEntries(data []byte) ([]string, map[string][]byte) {
+	names := make([]string, 0)
+	entries := map[string][]byte{}
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return names, entries
+		}
+		Expect(err).ToNot(HaveOccurred())
+		content, err := io.ReadAll(tr)
+		Expect(err).ToNot(HaveOccurred())
+		names = append(names, header.Name)
+		entries[header.Name] = content
+	}
+}
+
+// memoryBlobStore is a blob store that keeps all blobs in memory by their digest.
+type memoryBlobStore map[string][]byte
+
+func (s memoryBlobStore) Add(desc ocispecv1.Descriptor, reader io.ReadCloser) error {
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	s[desc.Digest.String()] = data
+	return nil
+}
+
 func defaultComponentDescriptor(name, version string) *cdv2.ComponentDescriptor {
 	cd := &cdv2.ComponentDescriptor{}
 	cd.Name = name
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RewriteRule describes a rule that rewrites oci references,
+// e.g. to resolve public registries through an internal mirror.
+type RewriteRule interface {
+	// Rewrite returns the rewritten reference and whether the rule matched the reference.
+	Rewrite(ref string) (string, bool)
+}
+
+// PrefixRewriteRule replaces the prefix of a reference.
+// The prefix only matches complete host or path segments,
+// so that the prefix "example.com/a" matches "example.com/a/b:v1" but not "example.com/ab:v1".
+type PrefixRewriteRule struct {
+	// Prefix is the prefix that is replaced.
+	Prefix string
+	// Replacement is the new prefix.
+	Replacement string
+}
+
+var _ RewriteRule = PrefixRewriteRule{}
+
+// NewPrefixRewriteRule creates a new rule that replaces the prefix of a reference.
+func NewPrefixRewriteRule(prefix, replacement string) PrefixRewriteRule {
+	return PrefixRewriteRule{
+		Prefix:      strings.TrimSuffix(prefix, "/"),
+		Replacement: strings.TrimSuffix(replacement, "/"),
+	}
+}
+
+func (r PrefixRewriteRule) Rewrite(ref string) (string, bool) {
+	if len(r.Prefix) == 0 || !strings.HasPrefix(ref, r.Prefix) {
+		return ref, false
+	}
+	rest := ref[len(r.Prefix):]
+	if len(rest) != 0 {
+		switch rest[0] {
+		case '/', '@':
+		case ':':
+			// a colon directly after the host is a port and not a tag separator.
+			if !strings.Contains(r.Prefix, "/") {
+				return ref, false
+			}
+		default:
+			return ref, false
+		}
+	}
+	return r.Replacement + rest, true
+}
+
+// RegexRewriteRule replaces all matches of a regular expression in a reference.
+// The replacement can reference submatches as described in regexp.Regexp.Expand.
+type RegexRewriteRule struct {
+	// Regexp is the expression that is matched.
+	Regexp *regexp.Regexp
+	// Replacement is the replacement of the matched parts of a reference.
+	Replacement string
+}
+
+var _ RewriteRule = RegexRewriteRule{}
+
+// NewRegexRewriteRule creates a new rule that replaces all matches of a regular expression in a reference.
+func NewRegexRewriteRule(expr, replacement string) (RegexRewriteRule, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return RegexRewriteRule{}, fmt.Errorf("unable to compile rewrite expression %q: %w", expr, err)
+	}
+	return RegexRewriteRule{
+		Regexp:      re,
+		Replacement: replacement,
+	}, nil
+}
+
+func (r RegexRewriteRule) Rewrite(ref string) (string, bool) {
+	if r.Regexp == nil || !r.Regexp.MatchString(ref) {
+		return ref, false
+	}
+	return r.Regexp.ReplaceAllString(ref, r.Replacement), true
+}
+
+// RewriteRules is a list of rewrite rules.
+// Only the first matching rule is applied to a reference.
+type RewriteRules []RewriteRule
+
+var _ RewriteRule = RewriteRules{}
+
+// Rewrite rewrites the reference with the first matching rule.
+// A url scheme of the reference is not matched by the rules and kept as it is.
+func (rules RewriteRules) Rewrite(ref string) (string, bool) {
+	scheme := ""
+	if i := strings.Index(ref, "://"); i != -1 {
+		scheme, ref = ref[:i+3], ref[i+3:]
+	}
+	for _, rule := range rules {
+		if rewritten, ok := rule.Rewrite(ref); ok {
+			return scheme + rewritten, true
+		}
+	}
+	return scheme + ref, false
+}
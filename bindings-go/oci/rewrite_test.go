@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci_test
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/oci"
+)
+
+var _ = Describe("rewrite", func() {
+
+	It("should only rewrite complete path segments with a prefix rule", func() {
+		rule := oci.NewPrefixRewriteRule("docker.io/library", "mirror.example.com/hub/")
+		ref, ok := rule.Rewrite("docker.io/library/ubuntu:18.04")
+		Expect(ok).To(BeTrue())
+		Expect(ref).To(Equal("mirror.example.com/hub/ubuntu:18.04"))
+
+		_, ok = rule.Rewrite("docker.io/library2/ubuntu:18.04")
+		Expect(ok).To(BeFalse())
+
+		ref, ok = oci.NewPrefixRewriteRule("docker.io/library/ubuntu", "mirror.example.com/ubuntu").Rewrite("docker.io/library/ubuntu:18.04")
+		Expect(ok).To(BeTrue())
+		Expect(ref).To(Equal("mirror.example.com/ubuntu:18.04"))
+
+		_, ok = oci.NewPrefixRewriteRule("example.com", "mirror.example.com").Rewrite("example.com:5000/a:v1")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should rewrite a reference with a regex rule", func() {
+		rule, err := oci.NewRegexRewriteRule(`^([a-z]+)\.gcr\.io/`, "mirror.example.com/gcr-$1/")
+		Expect(err).ToNot(HaveOccurred())
+		ref, ok := rule.Rewrite("eu.gcr.io/gardener-project/comp:v1")
+		Expect(ok).To(BeTrue())
+		Expect(ref).To(Equal("mirror.example.com/gcr-eu/gardener-project/comp:v1"))
+	})
+
+	It("should apply the first matching rule and keep the scheme", func() {
+		rules := oci.RewriteRules{
+			oci.NewPrefixRewriteRule("example.com/a", "first.example.com"),
+			oci.NewPrefixRewriteRule("example.com", "second.example.com"),
+		}
+		ref, ok := rules.Rewrite("https://example.com/a/b")
+		Expect(ok).To(BeTrue())
+		Expect(ref).To(Equal("https://first.example.com/b"))
+		ref, ok = rules.Rewrite("example.com/b")
+		Expect(ok).To(BeTrue())
+		Expect(ref).To(Equal("second.example.com/b"))
+	})
+
+	It("should resolve a component through a mirror without changing its repository context", func() {
+		ctx := context.Background()
+		cd := defaultComponentDescriptor("example.com/my-comp", "0.0.0")
+		client := newComponentTestClient(cd, nil, nil)
+		getManifest := client.getManifest
+		client.getManifest = func(ctx context.Context, ref string) (*ocispecv1.Manifest, error) {
+			Expect(ref).To(Equal("mirror.example.com/public/component-descriptors/example.com/my-comp:0.0.0"))
+			return getManifest(ctx, ref)
+		}
+		fetch := client.fetch
+		client.fetch = func(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+			Expect(strings.HasPrefix(ref, "mirror.example.com/public/")).To(BeTrue())
+			return fetch(ctx, ref, desc, writer)
+		}
+
+		resolver := oci.NewResolver(client).WithRewriteRules(oci.NewPrefixRewriteRule("registry.example.com", "mirror.example.com/public"))
+		res, err := resolver.Resolve(ctx, cdv2.NewOCIRegistryRepository("registry.example.com", ""), "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		repoCtx := &cdv2.OCIRegistryRepository{}
+		Expect(res.GetEffectiveRepositoryContext().DecodeInto(repoCtx)).To(Succeed())
+		Expect(repoCtx.BaseURL).To(Equal("registry.example.com"))
+
+		Expect(resolver.RewriteImageReference(ctx, "registry.example.com/image:v1")).To(Equal("mirror.example.com/public/image:v1"))
+	})
+
+	It("should rewrite the image references of resources without changing the resolved component descriptor", func() {
+		ctx := context.Background()
+		cd := defaultComponentDescriptor("example.com/my-comp", "0.0.0")
+		for name, ref := range map[string]string{
+			"mirrored": "registry.example.com/image:v1",
+			"other":    "other.example.com/image:v1",
+		} {
+			acc, err := cdv2.NewUnstructured(cdv2.NewOCIRegistryAccess(ref))
+			Expect(err).ToNot(HaveOccurred())
+			cd.Resources = append(cd.Resources, cdv2.Resource{
+				IdentityObjectMeta: cdv2.IdentityObjectMeta{Name: name, Version: "0.0.0", Type: cdv2.OCIImageType},
+				Relation:           cdv2.ExternalRelation,
+				Access:             &acc,
+			})
+		}
+		client := newComponentTestClient(cd, nil, nil)
+		repoCtx := cdv2.NewOCIRegistryRepository("registry.example.com", "")
+		rule := oci.NewPrefixRewriteRule("registry.example.com", "mirror.example.com/public")
+
+		imageReference := func(cd *cdv2.ComponentDescriptor, name string) string {
+			res, err := cd.GetResourceByIdentity(cdv2.Identity{cdv2.SystemIdentityName: name})
+			Expect(err).ToNot(HaveOccurred())
+			access := &cdv2.OCIRegistryAccess{}
+			Expect(res.Access.DecodeInto(access)).To(Succeed())
+			return access.ImageReference
+		}
+
+		resolver := oci.NewResolver(client).WithRewriteRules(rule)
+		res, err := resolver.Resolve(ctx, repoCtx, "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(imageReference(res, "mirrored")).To(Equal("registry.example.com/image:v1"))
+
+		rewritten, err := resolver.RewriteResources(ctx, res)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(imageReference(rewritten, "mirrored")).To(Equal("mirror.example.com/public/image:v1"))
+		Expect(imageReference(rewritten, "other")).To(Equal("other.example.com/image:v1"))
+		Expect(imageReference(res, "mirrored")).To(Equal("registry.example.com/image:v1"), "the resolved component descriptor must not be changed")
+
+		res, _, err = resolver.ResolveWithBlobResolver(ctx, repoCtx, "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(imageReference(res, "mirrored")).To(Equal("registry.example.com/image:v1"))
+	})
+
+})
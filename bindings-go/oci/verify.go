@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/opencontainers/go-digest"
+	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// VerificationError describes a fetched blob whose content does not match the digest or size of its descriptor.
+type VerificationError struct {
+	// Expected is the descriptor of the requested blob.
+	Expected ocispecv1.Descriptor
+	// ActualDigest is the digest of the received content.
+	// It is empty if the fetch was aborted because the content exceeded the expected size.
+	ActualDigest digest.Digest
+	// ActualSize is the number of received bytes.
+	ActualSize int64
+}
+
+var _ error = &VerificationError{}
+
+func (e *VerificationError) Error() string {
+	if (e.Expected.Size > 0 && e.ActualSize != e.Expected.Size) || len(e.Expected.Digest) == 0 {
+		return fmt.Sprintf("size mismatch for blob %s: expected %d bytes but got %d bytes", e.Expected.Digest, e.Expected.Size, e.ActualSize)
+	}
+	return fmt.Sprintf("digest mismatch for blob %s: got %s", e.Expected.Digest, e.ActualDigest)
+}
+
+// VerifyingWriter is a writer that computes the digest and size of the written content
+// so that it can be verified against the descriptor of the blob.
+type VerifyingWriter struct {
+	writer   io.Writer
+	desc     ocispecv1.Descriptor
+	digester digest.Digester
+	size     int64
+}
+
+var _ io.Writer = &VerifyingWriter{}
+
+// NewVerifyingWriter creates a new writer that verifies the content written to the given writer
+// against the digest and size of the descriptor.
+// The size is not verified if the descriptor does not define a size
+// and the digest is not verified if the descriptor does not define a digest.
+func NewVerifyingWriter(writer io.Writer, desc ocispecv1.Descriptor) (*VerifyingWriter, error) {
+	algorithm := digest.Canonical
+	if len(desc.Digest) != 0 {
+		if err := desc.Digest.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid digest %q: %w", desc.Digest, err)
+		}
+		algorithm = desc.Digest.Algorithm()
+	}
+	return &VerifyingWriter{
+		writer:   writer,
+		desc:     desc,
+		digester: algorithm.Digester(),
+	}, nil
+}
+
+// Write writes the content to the underlying writer.
+// The write fails without writing anything if the content exceeds the expected size.
+func (w *VerifyingWriter) Write(p []byte) (int, error) {
+	if w.desc.Size > 0 && w.size+int64(len(p)) > w.desc.Size {
+		return 0, &VerificationError{
+			Expected:   w.desc,
+			ActualSize: w.size + int64(len(p)),
+		}
+	}
+	n, err := w.writer.Write(p)
+	_, _ = w.digester.Hash().Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+// Verify verifies that the written content matches the digest and size of the descriptor.
+// A VerificationError is returned if the content does not match.
+func (w *VerifyingWriter) Verify() error {
+	actual := w.digester.Digest()
+	if (w.desc.Size > 0 && w.size != w.desc.Size) || (len(w.desc.Digest) != 0 && actual != w.desc.Digest) {
+		return &VerificationError{
+			Expected:     w.desc,
+			ActualDigest: actual,
+			ActualSize:   w.size,
+		}
+	}
+	return nil
+}
+
+// FetchAndVerify fetches the blob of the given descriptor and verifies its digest and size.
+func FetchAndVerify(ctx context.Context, client Client, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+	vw, err := NewVerifyingWriter(writer, desc)
+	if err != nil {
+		return err
+	}
+	if err := client.Fetch(ctx, ref, desc, vw); err != nil {
+		return err
+	}
+	return vw.Verify()
+}
@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2021 SAP SE or an SAP affiliate company and Gardener contributors.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	cdv2 "github.com/gardener/component-spec/bindings-go/apis/v2"
+	"github.com/gardener/component-spec/bindings-go/oci"
+)
+
+var _ = Describe("verify", func() {
+
+	It("should verify the written content", func() {
+		data := []byte("data")
+		var buf bytes.Buffer
+		vw, err := oci.NewVerifyingWriter(&buf, ocispecv1.Descriptor{
+			Digest: digest.FromBytes(data),
+			Size:   int64(len(data)),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = vw.Write(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vw.Verify()).To(Succeed())
+		Expect(buf.Bytes()).To(Equal(data))
+	})
+
+	It("should return a verification error if the digest does not match", func() {
+		vw, err := oci.NewVerifyingWriter(io.Discard, ocispecv1.Descriptor{
+			Digest: digest.FromString("data"),
+			Size:   4,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = vw.Write([]byte("atad"))
+		Expect(err).ToNot(HaveOccurred())
+
+		verr := &oci.VerificationError{}
+		Expect(errors.As(vw.Verify(), &verr)).To(BeTrue())
+		Expect(verr.ActualDigest).To(Equal(digest.FromString("atad")))
+	})
+
+	It("should abort writing if the content exceeds the expected size", func() {
+		var buf bytes.Buffer
+		vw, err := oci.NewVerifyingWriter(&buf, ocispecv1.Descriptor{
+			Digest: digest.FromString("data"),
+			Size:   4,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = vw.Write([]byte("data!"))
+		verr := &oci.VerificationError{}
+		Expect(errors.As(err, &verr)).To(BeTrue())
+		Expect(verr.ActualSize).To(Equal(int64(5)))
+		Expect(buf.Len()).To(Equal(0))
+	})
+
+	It("should only verify the size if the descriptor does not define a digest", func() {
+		vw, err := oci.NewVerifyingWriter(io.Discard, ocispecv1.Descriptor{Size: 4})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = vw.Write([]byte("data"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vw.Verify()).To(Succeed())
+
+		vw, err = oci.NewVerifyingWriter(io.Discard, ocispecv1.Descriptor{Size: 4})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = vw.Write([]byte("dat"))
+		Expect(err).ToNot(HaveOccurred())
+		verr := &oci.VerificationError{}
+		Expect(errors.As(vw.Verify(), &verr)).To(BeTrue())
+		Expect(verr.ActualSize).To(Equal(int64(3)))
+	})
+
+	It("should resolve an oci blob whose access does not define a digest", func() {
+		ctx := context.Background()
+		data := []byte("blob")
+		cd := defaultComponentDescriptor("example.com/my-comp", "0.0.0")
+		acc, err := cdv2.NewUnstructured(cdv2.NewOCIBlobAccess("example.com/my-comp", "application/octet-stream", "", int64(len(data))))
+		Expect(err).ToNot(HaveOccurred())
+		cd.Resources = append(cd.Resources, cdv2.Resource{
+			IdentityObjectMeta: cdv2.IdentityObjectMeta{
+				Name:    "res",
+				Version: "0.0.0",
+				Type:    "blob",
+			},
+			Relation: cdv2.LocalRelation,
+			Access:   &acc,
+		})
+		client := newComponentTestClient(cd, nil, nil)
+		fetch := client.fetch
+		client.fetch = func(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+			if len(desc.Digest) == 0 {
+				_, err := writer.Write(data)
+				return err
+			}
+			return fetch(ctx, ref, desc, writer)
+		}
+
+		res, blobResolver, err := oci.NewResolver(client).ResolveWithBlobResolver(ctx, cdv2.NewOCIRegistryRepository("example.com", ""), "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		var buf bytes.Buffer
+		_, err = blobResolver.Resolve(ctx, res.Resources[0], &buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.Bytes()).To(Equal(data))
+	})
+
+	It("should fail to resolve a component descriptor if the layer is corrupted", func() {
+		ctx := context.Background()
+		client := newComponentTestClient(defaultComponentDescriptor("example.com/my-comp", "0.0.0"), nil, nil)
+		fetch := client.fetch
+		client.fetch = func(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+			if desc.MediaType != oci.ComponentDescriptorJSONMimeType {
+				return fetch(ctx, ref, desc, writer)
+			}
+			var buf bytes.Buffer
+			if err := fetch(ctx, ref, desc, &buf); err != nil {
+				return err
+			}
+			data := buf.Bytes()
+			data[0] = ' '
+			_, err := writer.Write(data)
+			return err
+		}
+
+		_, err := oci.NewResolver(client).Resolve(ctx, cdv2.NewOCIRegistryRepository("example.com", ""), "example.com/my-comp", "0.0.0")
+		verr := &oci.VerificationError{}
+		Expect(errors.As(err, &verr)).To(BeTrue())
+	})
+
+	It("should fail to resolve a local blob if the content is corrupted", func() {
+		ctx := context.Background()
+		data := []byte("blob")
+		cd := defaultComponentDescriptor("example.com/my-comp", "0.0.0")
+		acc, err := cdv2.NewUnstructured(cdv2.NewLocalOCIBlobAccess(digest.FromBytes(data).String()))
+		Expect(err).ToNot(HaveOccurred())
+		cd.Resources = append(cd.Resources, cdv2.Resource{
+			IdentityObjectMeta: cdv2.IdentityObjectMeta{
+				Name:    "res",
+				Version: "0.0.0",
+				Type:    "blob",
+			},
+			Relation: cdv2.LocalRelation,
+			Access:   &acc,
+		})
+		client := newComponentTestClient(cd, map[string][]byte{digest.FromBytes(data).String(): data}, nil)
+		fetch := client.fetch
+		client.fetch = func(ctx context.Context, ref string, desc ocispecv1.Descriptor, writer io.Writer) error {
+			if desc.Digest == digest.FromBytes(data) {
+				_, err := writer.Write([]byte("blub"))
+				return err
+			}
+			return fetch(ctx, ref, desc, writer)
+		}
+
+		res, blobResolver, err := oci.NewResolver(client).ResolveWithBlobResolver(ctx, cdv2.NewOCIRegistryRepository("example.com", ""), "example.com/my-comp", "0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = blobResolver.Resolve(ctx, res.Resources[0], io.Discard)
+		verr := &oci.VerificationError{}
+		Expect(errors.As(err, &verr)).To(BeTrue())
+	})
+
+})